@@ -3,8 +3,13 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/mona-actions/gh-migrate-variables/internal/api"
+	"github.com/mona-actions/gh-migrate-variables/internal/config"
+	"github.com/pterm/pterm"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -27,6 +32,8 @@ func GetFlagOrViperValue(cmd *cobra.Command, flags map[string]bool) map[string]s
 			value = kebabVal
 		} else if prefixedVal != "" {
 			value = prefixedVal
+		} else if fileVal := getValueFromFile(cmd, name+"-file"); fileVal != "" {
+			value = fileVal
 		}
 
 		if value != "" {
@@ -46,6 +53,118 @@ func GetFlagOrViperValue(cmd *cobra.Command, flags map[string]bool) map[string]s
 	return values
 }
 
+// Resolves the tuning options shared by all commands and applies the retry policy, exiting if any option is invalid
+func GetRuntimeConfig() config.RuntimeConfig {
+	retryMax := viper.GetInt("RETRY_MAX")
+	retryDelay := getDurationOption("RETRY_DELAY", "retry delay", 0)
+
+	cfg := config.RuntimeConfig{
+		RetryMax:               retryMax,
+		RetryDelay:             retryDelay,
+		NetworkRetryMax:        getIntOption("GHMV_NETWORK_RETRY_MAX", retryMax),
+		NetworkRetryDelay:      getDurationOption("GHMV_NETWORK_RETRY_DELAY", "network retry delay", retryDelay),
+		RateLimitRetryMax:      getIntOption("GHMV_RATE_LIMIT_RETRY_MAX", retryMax),
+		RateLimitMaxWait:       getDurationOption("GHMV_RATE_LIMIT_MAX_WAIT", "rate limit max wait", 0),
+		RetryStatusCodes:       getStatusCodesOption("GHMV_RETRY_STATUS_CODES"),
+		OrgConcurrency:         viper.GetInt("GHMV_ORG_CONCURRENCY"),
+		RepoConcurrency:        viper.GetInt("GHMV_REPO_CONCURRENCY"),
+		EnvironmentConcurrency: getIntOption("GHMV_VARIABLE_CONCURRENCY", viper.GetInt("GHMV_ENVIRONMENT_CONCURRENCY")),
+		FlushInterval:          viper.GetDuration("GHMV_FLUSH_INTERVAL"),
+		RepoBatchDelay:         viper.GetDuration("GHMV_REPO_BATCH_DELAY"),
+		RepoBatchSize:          getIntOption("GHMV_REPO_BATCH_SIZE", 1),
+		PageSize:               viper.GetInt("GHMV_PAGE_SIZE"),
+		MaxIdleConns:           viper.GetInt("GHMV_MAX_IDLE_CONNS"),
+		IdleConnTimeout:        getDurationOption("GHMV_IDLE_CONN_TIMEOUT", "idle connection timeout", 0),
+		MaxFailures:            viper.GetInt("GHMV_MAX_FAILURES"),
+	}
+	// GitHub serves between 1 and 100 items per page, so other sizes are clamped rather than rejected
+	if pageSize := min(max(cfg.PageSize, 1), api.MaxPageSize); pageSize != cfg.PageSize {
+		fmt.Fprintf(os.Stderr, "Warning: page size %d is out of range, using %d\n", cfg.PageSize, pageSize)
+		cfg.PageSize = pageSize
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	api.SetRetryPolicy(cfg.RetryMax, cfg.RetryDelay)
+	api.SetNetworkRetryPolicy(cfg.NetworkRetryMax, cfg.NetworkRetryDelay)
+	api.SetRateLimitRetryPolicy(cfg.RateLimitRetryMax, cfg.RateLimitMaxWait)
+	api.SetRetryStatusCodes(cfg.RetryStatusCodes)
+	api.SetPageSize(cfg.PageSize)
+	api.SetConnectionPool(cfg.MaxIdleConns, cfg.IdleConnTimeout)
+	return cfg
+}
+
+// Returns an integer option, or the fallback when it is unset or zero
+func getIntOption(key string, fallback int) int {
+	if value := viper.GetInt(key); value != 0 {
+		return value
+	}
+	return fallback
+}
+
+// Parses a duration option such as 500ms or 2s, returning the fallback when it is unset and exiting if it is invalid
+func getDurationOption(key, description string, fallback time.Duration) time.Duration {
+	value := viper.GetString(key)
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid %s %q: %v\n", description, value, err)
+		os.Exit(1)
+	}
+	return duration
+}
+
+// Parses a comma-separated list of HTTP status codes such as 502,503, exiting if any isn't a number
+func getStatusCodesOption(key string) []int {
+	var codes []int
+	for _, value := range strings.Split(viper.GetString(key), ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		code, err := strconv.Atoi(value)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid retry status code %q: must be a number\n", value)
+			os.Exit(1)
+		}
+		codes = append(codes, code)
+	}
+	return codes
+}
+
+// Binds flags defined by more than one command to their GHMV_ keys, for the running command only,
+// as binding them at init would leave the key bound to whichever command registered last
+func bindCommandFlags(cmd *cobra.Command, names ...string) {
+	for _, name := range names {
+		viper.BindPFlag("GHMV_"+strings.ToUpper(strings.ReplaceAll(name, "-", "_")), cmd.Flags().Lookup(name))
+	}
+}
+
+// Reads a value from the file named by the given flag (e.g. --source-token-file), trimming surrounding whitespace
+func getValueFromFile(cmd *cobra.Command, flagName string) string {
+	if cmd.Flags().Lookup(flagName) == nil {
+		return ""
+	}
+
+	path, _ := cmd.Flags().GetString(flagName)
+	if path == "" {
+		path = viper.GetString("GHMV_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_")))
+	}
+	if path == "" {
+		return ""
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: cannot read --%s %s: %v\n", flagName, path, err)
+		os.Exit(1)
+	}
+	return strings.TrimSpace(string(content))
+}
+
 func ShowConnectionStatus(actionType string) {
 	var endpoint string // Declare endpoint once
 
@@ -63,6 +182,10 @@ func ShowConnectionStatus(actionType string) {
 
 	fmt.Println(getHostnameMessage(hostname))
 	fmt.Println(getProxyStatus(httpProxy, httpsProxy))
+
+	if viper.GetBool("GHMV_INSECURE_SKIP_VERIFY") {
+		pterm.Warning.Println("TLS certificate verification is DISABLED (--insecure-skip-verify). Connections are vulnerable to interception.")
+	}
 }
 
 func getNormalizedEndpoint(key string) string {
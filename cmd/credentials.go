@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Returns the path of the credentials file, ~/.config/gh-migrate-variables/credentials.yaml unless GHMV_CREDENTIALS_FILE is set
+func credentialsFilePath() (string, error) {
+	if path := viper.GetString("GHMV_CREDENTIALS_FILE"); path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot locate credentials file: %w", err)
+	}
+	return filepath.Join(home, ".config", "gh-migrate-variables", "credentials.yaml"), nil
+}
+
+// Loads the hostname and token of a named profile in the credentials file as defaults for one side
+// of the migration, source or target, so explicit flags and environment variables still win.
+func loadCredentials(name, side string) error {
+	path, err := credentialsFilePath()
+	if err != nil {
+		return err
+	}
+
+	credentials := viper.New()
+	credentials.SetConfigFile(path)
+	credentials.SetConfigType("yaml")
+	if err := credentials.ReadInConfig(); err != nil {
+		return fmt.Errorf("cannot read credentials file %s: %w", path, err)
+	}
+	// Tokens shouldn't be readable by other users
+	if info, err := os.Stat(path); err == nil && info.Mode().Perm()&0077 != 0 {
+		fmt.Fprintf(os.Stderr, "Warning: credentials file %s is accessible by other users; restrict it with chmod 600\n", path)
+	}
+
+	if !credentials.IsSet(name) {
+		return fmt.Errorf("profile %q not found in credentials file %s", name, path)
+	}
+	hostname := credentials.GetString(name + ".hostname")
+	token := credentials.GetString(name + ".token")
+	if token == "" {
+		return fmt.Errorf("profile %q in credentials file %s has no token", name, path)
+	}
+
+	prefix := "GHMV_" + strings.ToUpper(side)
+	if hostname != "" {
+		viper.SetDefault(prefix+"_HOSTNAME", hostname)
+	}
+	viper.SetDefault(prefix+"_TOKEN", token)
+	return nil
+}
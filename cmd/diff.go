@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mona-actions/gh-migrate-variables/pkg/diff"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var DiffCmd = &cobra.Command{
+	Use:   "diff <file-a> <file-b>",
+	Short: "Compare two exported variables CSV files",
+	Long:  "Compare two exported variables CSV files, reporting variables only in one file or with differing values or visibility. Exits non-zero when differences are found.",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		viper.Set("GHMV_DIFF_FILE_A", args[0])
+		viper.Set("GHMV_DIFF_FILE_B", args[1])
+
+		if err := diff.DiffVariables(); err != nil {
+			fmt.Printf("failed to diff variables: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	DiffCmd.Flags().Bool("ignore-whitespace", false, "Treat values differing only in leading or trailing whitespace as equal")
+	DiffCmd.Flags().Bool("case-insensitive-values", false, "Treat values differing only in letter case as equal, such as true and True")
+
+	viper.BindPFlag("GHMV_DIFF_IGNORE_WHITESPACE", DiffCmd.Flags().Lookup("ignore-whitespace"))
+	viper.BindPFlag("GHMV_DIFF_CASE_INSENSITIVE_VALUES", DiffCmd.Flags().Lookup("case-insensitive-values"))
+}
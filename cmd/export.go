@@ -2,7 +2,10 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"time"
 
+	"github.com/mona-actions/gh-migrate-variables/internal/summary"
 	"github.com/mona-actions/gh-migrate-variables/pkg/export"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -19,23 +22,108 @@ var ExportCmd = &cobra.Command{
 			"source-organization": true,
 			"source-token":        true,
 			"search-depth":        false,
+			"report-file":         false,
 		})
+		bindCommandFlags(cmd, "warn-on-empty-value", "strict-empty-values", "summary-json", "compact")
+		// Keep standard output clean for the exported data
+		if viper.GetBool("GHMV_STDOUT") {
+			export.UseStdout()
+		}
+		if viper.GetBool("GHMV_SUMMARY_JSON") {
+			summary.UseJSON()
+		}
+		runtimeConfig := GetRuntimeConfig()
 		ShowConnectionStatus("export")
-		if err := export.ExportVariables(); err != nil {
-			fmt.Printf("failed to export variables: %v\n", err)
+		if err := export.ExportVariables(runtimeConfig); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to export variables: %v\n", err)
+			os.Exit(1)
 		}
-		return
 	},
 }
 
 func init() {
 	// Add flags to the ExportCmd
 	ExportCmd.Flags().StringP("source-hostname", "n", "", "GitHub Enterprise Server hostname (optional) Ex. github.example.com")
-	ExportCmd.Flags().StringP("source-organization", "o", "", "Organization to export (required)")
+	ExportCmd.Flags().StringP("source-organization", "o", "", "Organization to export, or a comma-separated list of organizations (required)")
 	ExportCmd.Flags().StringP("source-token", "t", "", "GitHub token (required)")
+	ExportCmd.Flags().String("source-profile", "", "Profile in the credentials file providing the source hostname and token (optional)")
+	ExportCmd.Flags().String("source-token-file", "", "File containing the GitHub token, as an alternative to --source-token")
+	ExportCmd.Flags().String("source-token-command", "", "Command printing a new token when the token expires mid-run, such as gh auth token (optional)")
+	ExportCmd.Flags().String("repo-sort", "", "Order in which repositories are scanned: full_name, created, updated, or pushed (optional)")
+	ExportCmd.Flags().Int("max-repos", 0, "Maximum number of repositories to export variables from (0 for unlimited)")
+	ExportCmd.Flags().Bool("continue-on-auth-error", false, "Skip organizations that are inaccessible with the token instead of aborting")
+	ExportCmd.Flags().String("output-file", "", "Write the output to this local path, or upload it to an s3:// or gs:// URL, instead of <org>_variables.csv; a .zip path holds a CSV per repository (optional)")
+	ExportCmd.Flags().String("output-format", "csv", "Output format: csv, sh for a script of gh variable set commands, or gitops for a YAML file per repository")
+	ExportCmd.Flags().String("schema", "standard", "Column layout of the CSV output: standard, or compat for the layout of the secrets-migration tool")
+	ExportCmd.Flags().String("output-encoding", "utf-8", "Character encoding of the CSV output: utf-8, utf-16, utf-16le, utf-16be, latin-1, or windows-1252")
+	ExportCmd.Flags().String("baseline", "", "Previously exported CSV; only new or changed variables are exported (optional)")
+	ExportCmd.Flags().Bool("detect-conflicts", false, "Report organization variables shadowed by repository or environment variables of the same name")
+	ExportCmd.Flags().Bool("export-metadata-only", false, "Write the number of variables in each repository instead of the variables, to <org>_variable_counts.csv")
+	ExportCmd.Flags().Bool("compact", false, "Print only warnings, errors, and the summary, leaving out a line per repository")
+	ExportCmd.Flags().Bool("explain", false, "Explain empty results by counting Actions secrets, which this tool doesn't export")
+	ExportCmd.Flags().Duration("flush-interval", 5*time.Second, "How often variables written so far are flushed to the output file, so an interrupted export leaves a partial file")
+	ExportCmd.Flags().Bool("names-only", false, "Write only variable names, scopes, visibilities, and environments, leaving out values")
+	ExportCmd.Flags().Bool("no-clobber", false, "Fail instead of overwriting an existing output file")
+	ExportCmd.Flags().Bool("only-repos-with-actions", false, "Check each repository's Actions permissions and skip those with Actions disabled before fetching variables")
+	ExportCmd.Flags().Int("org-concurrency", 1, "Maximum number of organizations exported concurrently")
+	ExportCmd.Flags().Int("repo-concurrency", 1, "Maximum number of repositories scanned concurrently within an organization")
+	ExportCmd.Flags().Duration("repo-batch-delay", 0, "Pause between repositories, or between batches of --repo-batch-size repositories, for throttled servers")
+	ExportCmd.Flags().Int("repo-batch-size", 1, "Number of repositories started between pauses of --repo-batch-delay")
+	ExportCmd.Flags().Int("environment-concurrency", 5, "Maximum number of environments scanned concurrently within a repository")
+	ExportCmd.Flags().Int("variable-concurrency", 0, "Alias of --environment-concurrency, taking precedence when set")
+	ExportCmd.Flags().String("exclude-topics", "", "Skip repositories with any of these topics, comma-separated, such as archived,template (optional)")
+	ExportCmd.Flags().String("team", "", "Export only the repositories this team has access to, by team slug (optional)")
+	ExportCmd.Flags().String("validate-output", "", "Check names and values for invalid UTF-8 and control characters: warn, or reject to leave them out (optional)")
+	ExportCmd.Flags().Bool("warn-on-empty-value", false, "Warn about variables whose value is empty")
+	ExportCmd.Flags().Bool("strict-empty-values", false, "Leave out variables whose value is empty and report them as errors")
+	ExportCmd.Flags().String("value-filter", "", "Export only variables whose value matches this regular expression (optional)")
+	ExportCmd.Flags().String("visibility-filter", "", "Export only organization variables with these visibilities, comma-separated: all, private, or selected (optional)")
+	ExportCmd.Flags().Bool("with-repo-metadata", false, "Add repository default branch and visibility columns to the CSV")
+	ExportCmd.Flags().Bool("with-timestamps", false, "Add columns with when each variable was created and last updated")
+	ExportCmd.Flags().Bool("dedup", false, "With several organizations, also write variables_dedup.csv, listing each distinct name and value once with the organizations it appears in")
+	ExportCmd.Flags().Bool("qualified-scope", false, "Write scopes as org:<name>, repo:<name>, or env:<repo>/<env> so they can't be ambiguous")
+	ExportCmd.Flags().Bool("stdout", false, "Write the exported data to standard output and all other output to standard error")
+	ExportCmd.Flags().Bool("resume", false, "Continue an interrupted export, appending to its partial output file instead of scanning every repository again")
+	ExportCmd.Flags().String("report-file", "", "Write a JSON report of the run to this file (optional)")
+	ExportCmd.Flags().Bool("summary-json", false, "Print the summary as a line of JSON on standard output, sending all other output to standard error")
 
 	// Bind flags to viper
 	viper.BindPFlag("GHMV_SOURCE_HOSTNAME", ExportCmd.Flags().Lookup("source-hostname"))
 	viper.BindPFlag("GHMV_SOURCE_ORGANIZATION", ExportCmd.Flags().Lookup("source-organization"))
 	viper.BindPFlag("GHMV_SOURCE_TOKEN", ExportCmd.Flags().Lookup("source-token"))
+	viper.BindPFlag("GHMV_SOURCE_PROFILE", ExportCmd.Flags().Lookup("source-profile"))
+	viper.BindPFlag("GHMV_SOURCE_TOKEN_FILE", ExportCmd.Flags().Lookup("source-token-file"))
+	viper.BindPFlag("GHMV_SOURCE_TOKEN_COMMAND", ExportCmd.Flags().Lookup("source-token-command"))
+	viper.BindPFlag("GHMV_REPO_SORT", ExportCmd.Flags().Lookup("repo-sort"))
+	viper.BindPFlag("GHMV_MAX_REPOS", ExportCmd.Flags().Lookup("max-repos"))
+	viper.BindPFlag("GHMV_OUTPUT_FORMAT", ExportCmd.Flags().Lookup("output-format"))
+	viper.BindPFlag("GHMV_SCHEMA", ExportCmd.Flags().Lookup("schema"))
+	viper.BindPFlag("GHMV_OUTPUT_ENCODING", ExportCmd.Flags().Lookup("output-encoding"))
+	viper.BindPFlag("GHMV_OUTPUT_FILE", ExportCmd.Flags().Lookup("output-file"))
+	viper.BindPFlag("GHMV_BASELINE", ExportCmd.Flags().Lookup("baseline"))
+	viper.BindPFlag("GHMV_DETECT_CONFLICTS", ExportCmd.Flags().Lookup("detect-conflicts"))
+	viper.BindPFlag("GHMV_EXPLAIN", ExportCmd.Flags().Lookup("explain"))
+	viper.BindPFlag("GHMV_EXPORT_METADATA_ONLY", ExportCmd.Flags().Lookup("export-metadata-only"))
+	viper.BindPFlag("GHMV_FLUSH_INTERVAL", ExportCmd.Flags().Lookup("flush-interval"))
+	viper.BindPFlag("GHMV_NAMES_ONLY", ExportCmd.Flags().Lookup("names-only"))
+	viper.BindPFlag("GHMV_NO_CLOBBER", ExportCmd.Flags().Lookup("no-clobber"))
+	viper.BindPFlag("GHMV_ONLY_REPOS_WITH_ACTIONS", ExportCmd.Flags().Lookup("only-repos-with-actions"))
+	viper.BindPFlag("GHMV_ORG_CONCURRENCY", ExportCmd.Flags().Lookup("org-concurrency"))
+	viper.BindPFlag("GHMV_REPO_CONCURRENCY", ExportCmd.Flags().Lookup("repo-concurrency"))
+	viper.BindPFlag("GHMV_REPO_BATCH_DELAY", ExportCmd.Flags().Lookup("repo-batch-delay"))
+	viper.BindPFlag("GHMV_REPO_BATCH_SIZE", ExportCmd.Flags().Lookup("repo-batch-size"))
+	viper.BindPFlag("GHMV_ENVIRONMENT_CONCURRENCY", ExportCmd.Flags().Lookup("environment-concurrency"))
+	viper.BindPFlag("GHMV_VARIABLE_CONCURRENCY", ExportCmd.Flags().Lookup("variable-concurrency"))
+	viper.BindPFlag("GHMV_WITH_REPO_METADATA", ExportCmd.Flags().Lookup("with-repo-metadata"))
+	viper.BindPFlag("GHMV_WITH_TIMESTAMPS", ExportCmd.Flags().Lookup("with-timestamps"))
+	viper.BindPFlag("GHMV_CONTINUE_ON_AUTH_ERROR", ExportCmd.Flags().Lookup("continue-on-auth-error"))
+	viper.BindPFlag("GHMV_EXCLUDE_TOPICS", ExportCmd.Flags().Lookup("exclude-topics"))
+	viper.BindPFlag("GHMV_TEAM", ExportCmd.Flags().Lookup("team"))
+	viper.BindPFlag("GHMV_VALIDATE_OUTPUT", ExportCmd.Flags().Lookup("validate-output"))
+	viper.BindPFlag("GHMV_VALUE_FILTER", ExportCmd.Flags().Lookup("value-filter"))
+	viper.BindPFlag("GHMV_VISIBILITY_FILTER", ExportCmd.Flags().Lookup("visibility-filter"))
+	viper.BindPFlag("GHMV_QUALIFIED_SCOPE", ExportCmd.Flags().Lookup("qualified-scope"))
+	viper.BindPFlag("GHMV_DEDUP", ExportCmd.Flags().Lookup("dedup"))
+	viper.BindPFlag("GHMV_RESUME", ExportCmd.Flags().Lookup("resume"))
+	viper.BindPFlag("GHMV_STDOUT", ExportCmd.Flags().Lookup("stdout"))
 }
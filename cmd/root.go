@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -24,19 +26,57 @@ func init() {
 	rootCmd.PersistentFlags().String("http-proxy", "", "HTTP proxy (can also use HTTP_PROXY env var)")
 	rootCmd.PersistentFlags().String("https-proxy", "", "HTTPS proxy (can also use HTTPS_PROXY env var)")
 	rootCmd.PersistentFlags().String("no-proxy", "", "No proxy list (can also use NO_PROXY env var)")
+	rootCmd.PersistentFlags().String("proxy-user", "", "User for proxies that require authentication, when the proxy URL has no credentials")
+	rootCmd.PersistentFlags().String("proxy-password", "", "Password for --proxy-user")
+	rootCmd.PersistentFlags().Int("page-size", 100, "Number of items requested per page when listing repositories, variables, and environments (1-100)")
 	rootCmd.PersistentFlags().Int("retry-max", 3, "Maximum retry attempts")
 	rootCmd.PersistentFlags().String("retry-delay", "1s", "Delay between retries")
+	rootCmd.PersistentFlags().Int("network-retry-max", 0, "Maximum attempts for transient network errors (defaults to --retry-max)")
+	rootCmd.PersistentFlags().String("network-retry-delay", "", "Delay between retries of transient network errors (defaults to --retry-delay)")
+	rootCmd.PersistentFlags().Int("rate-limit-retry-max", 0, "Maximum attempts for rate-limit errors (defaults to --retry-max)")
+	rootCmd.PersistentFlags().String("retry-status-codes", "", "Retry only failed calls with these HTTP status codes, comma-separated, instead of every failed call")
+	rootCmd.PersistentFlags().String("rate-limit-max-wait", "", "Longest wait for a rate limit to reset before retrying (defaults to backing off from --retry-delay)")
+	rootCmd.PersistentFlags().Int("max-idle-conns", 100, "Maximum idle connections kept open for reuse by concurrent requests")
+	rootCmd.PersistentFlags().String("idle-conn-timeout", "90s", "How long an idle connection is kept open for reuse (0 to keep it open)")
+	rootCmd.PersistentFlags().String("ca-cert", "", "Path to a PEM bundle of additional trusted CA certificates")
+	rootCmd.PersistentFlags().Bool("insecure-skip-verify", false, "Disable TLS certificate verification (dangerous, use only for testing)")
+	rootCmd.PersistentFlags().String("min-tls-version", "1.2", "Lowest TLS version accepted when connecting: 1.0, 1.1, 1.2, or 1.3")
+	rootCmd.PersistentFlags().String("profile", "", "YAML or JSON file of command options; flags and environment variables take precedence")
+	rootCmd.PersistentFlags().String("debug-http-file", "", "Log the method, URL, status, and timing of every HTTP request to this file")
+	rootCmd.PersistentFlags().String("summary-template", "", "Go text/template file used to print the run summary instead of the default")
+	rootCmd.PersistentFlags().StringArray("header", nil, "Additional HTTP header to send with every request, as key=value (repeatable)")
 
 	// Bind flags to viper
 	viper.BindPFlag("HTTP_PROXY", rootCmd.PersistentFlags().Lookup("http-proxy"))
 	viper.BindPFlag("HTTPS_PROXY", rootCmd.PersistentFlags().Lookup("https-proxy"))
 	viper.BindPFlag("NO_PROXY", rootCmd.PersistentFlags().Lookup("no-proxy"))
+	viper.BindPFlag("GHMV_PROXY_USER", rootCmd.PersistentFlags().Lookup("proxy-user"))
+	viper.BindPFlag("GHMV_PROXY_PASSWORD", rootCmd.PersistentFlags().Lookup("proxy-password"))
+	viper.BindPFlag("GHMV_PAGE_SIZE", rootCmd.PersistentFlags().Lookup("page-size"))
 	viper.BindPFlag("RETRY_MAX", rootCmd.PersistentFlags().Lookup("retry-max"))
 	viper.BindPFlag("RETRY_DELAY", rootCmd.PersistentFlags().Lookup("retry-delay"))
+	viper.BindEnv("RETRY_MAX", "GHMV_RETRY_MAX", "RETRY_MAX")
+	viper.BindEnv("RETRY_DELAY", "GHMV_RETRY_DELAY", "RETRY_DELAY")
+	viper.BindPFlag("GHMV_NETWORK_RETRY_MAX", rootCmd.PersistentFlags().Lookup("network-retry-max"))
+	viper.BindPFlag("GHMV_NETWORK_RETRY_DELAY", rootCmd.PersistentFlags().Lookup("network-retry-delay"))
+	viper.BindPFlag("GHMV_RATE_LIMIT_RETRY_MAX", rootCmd.PersistentFlags().Lookup("rate-limit-retry-max"))
+	viper.BindPFlag("GHMV_RATE_LIMIT_MAX_WAIT", rootCmd.PersistentFlags().Lookup("rate-limit-max-wait"))
+	viper.BindPFlag("GHMV_RETRY_STATUS_CODES", rootCmd.PersistentFlags().Lookup("retry-status-codes"))
+	viper.BindPFlag("GHMV_MAX_IDLE_CONNS", rootCmd.PersistentFlags().Lookup("max-idle-conns"))
+	viper.BindPFlag("GHMV_IDLE_CONN_TIMEOUT", rootCmd.PersistentFlags().Lookup("idle-conn-timeout"))
+	viper.BindPFlag("GHMV_CA_CERT", rootCmd.PersistentFlags().Lookup("ca-cert"))
+	viper.BindPFlag("GHMV_INSECURE_SKIP_VERIFY", rootCmd.PersistentFlags().Lookup("insecure-skip-verify"))
+	viper.BindPFlag("GHMV_MIN_TLS_VERSION", rootCmd.PersistentFlags().Lookup("min-tls-version"))
+	viper.BindPFlag("GHMV_PROFILE", rootCmd.PersistentFlags().Lookup("profile"))
+	viper.BindPFlag("GHMV_DEBUG_HTTP_FILE", rootCmd.PersistentFlags().Lookup("debug-http-file"))
+	viper.BindPFlag("GHMV_SUMMARY_TEMPLATE", rootCmd.PersistentFlags().Lookup("summary-template"))
+	viper.BindPFlag("GHMV_HEADER", rootCmd.PersistentFlags().Lookup("header"))
 
 	// Add subcommands
 	rootCmd.AddCommand(ExportCmd)
 	rootCmd.AddCommand(SyncCmd)
+	rootCmd.AddCommand(DiffCmd)
+	rootCmd.AddCommand(ValidateCmd)
 
 	// hide -h, --help from global/proxy flags
 	rootCmd.Flags().BoolP("help", "h", false, "")
@@ -58,4 +98,42 @@ func initConfig() {
 
 	// Read from environment
 	viper.AutomaticEnv()
+
+	// Load a migration profile, if provided
+	if profile := viper.GetString("GHMV_PROFILE"); profile != "" {
+		if err := loadProfile(profile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Load named credentials after the migration profile, which may select them
+	for _, side := range []string{"source", "target"} {
+		if name := viper.GetString("GHMV_" + strings.ToUpper(side) + "_PROFILE"); name != "" {
+			if err := loadCredentials(name, side); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+}
+
+// Loads options from a profile file as defaults, so explicit flags and environment variables still win.
+// Keys use flag names, e.g. source-organization or max-repos.
+func loadProfile(path string) error {
+	profile := viper.New()
+	profile.SetConfigFile(path)
+	if err := profile.ReadInConfig(); err != nil {
+		return fmt.Errorf("cannot read profile %s: %w", path, err)
+	}
+
+	for _, key := range profile.AllKeys() {
+		value := profile.Get(key)
+		envName := strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+		viper.SetDefault("GHMV_"+envName, value)
+		// Global options such as https-proxy and retry-max are read without the prefix
+		viper.SetDefault(envName, value)
+	}
+
+	return nil
 }
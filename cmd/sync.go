@@ -2,7 +2,9 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 
+	"github.com/mona-actions/gh-migrate-variables/internal/summary"
 	"github.com/mona-actions/gh-migrate-variables/pkg/sync"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -14,31 +16,98 @@ var SyncCmd = &cobra.Command{
 	Long:  "Sync organization and repository variables from CSV",
 	Run: func(cmd *cobra.Command, args []string) {
 		GetFlagOrViperValue(cmd, map[string]bool{
-			"file":                true,
+			"file":                false,
 			"target-hostname":     false,
 			"target-organization": true,
 			"target-token":        true,
+			"target-org-token":    false,
+			"source-organization": false,
+			"source-hostname":     false,
+			"report-file":         false,
 		})
+		// A plan from --apply-plan takes the place of the CSV file
+		if viper.GetString("file") == "" && viper.GetString("GHMV_APPLY_PLAN") == "" {
+			fmt.Fprintf(os.Stderr, "Error: missing required values: file\n")
+			os.Exit(1)
+		}
+		bindCommandFlags(cmd, "warn-on-empty-value", "strict-empty-values", "summary-json", "compact")
+		// Keep standard output clean for the JSON summary
+		if viper.GetBool("GHMV_SUMMARY_JSON") {
+			summary.UseJSON()
+		}
 
+		runtimeConfig := GetRuntimeConfig()
 		ShowConnectionStatus("sync")
-		
-		if err := sync.SyncVariables(); err != nil {
-			fmt.Printf("failed to export variables: %v\n", err)
+		if err := sync.SyncVariables(runtimeConfig); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to sync variables: %v\n", err)
+			os.Exit(1)
 		}
-		return
 	},
 }
 
 func init() {
 	// Add flags to the SyncCmd
-	SyncCmd.Flags().StringP("file", "f", "", "CSV file containing variables to synchronize")
+	SyncCmd.Flags().StringP("file", "f", "", "CSV file containing variables to synchronize, as a local path or an http(s) URL")
+	SyncCmd.Flags().String("input-encoding", "utf-8", "Character encoding of the CSV file: utf-8, utf-16, utf-16le, utf-16be, latin-1, or windows-1252")
 	SyncCmd.Flags().StringP("target-hostname", "n", "", "GitHub Enterprise Server hostname URL (optional) Ex. https://github.example.com")
 	SyncCmd.Flags().StringP("target-organization", "o", "", "Organization to sync (required)")
 	SyncCmd.Flags().StringP("target-token", "t", "", "GitHub token (required)")
+	SyncCmd.Flags().String("target-org-token", "", "GitHub token for organization variables, when it differs from --target-token (optional)")
+	SyncCmd.Flags().String("target-profile", "", "Profile in the credentials file providing the target hostname and token (optional)")
+	SyncCmd.Flags().String("target-token-file", "", "File containing the GitHub token, as an alternative to --target-token")
+	SyncCmd.Flags().String("target-token-command", "", "Command printing a new token when the token expires mid-run, such as gh auth token (optional)")
+	SyncCmd.Flags().Bool("strict-skips", false, "Count skipped variables (e.g. missing target repositories) as failures")
+	SyncCmd.Flags().Int("max-failures", 0, "Abort the sync once this many variables have failed (0 for unlimited)")
+	SyncCmd.Flags().String("error-file", "", "Write failed variables and their errors to this CSV file instead of printing them (optional)")
+	SyncCmd.Flags().Bool("progress", false, "Show a live status line instead of a line per variable")
+	SyncCmd.Flags().Bool("verbose", false, "Print a line per variable even when --progress is set")
+	SyncCmd.Flags().Bool("compact", false, "Print only warnings, errors, and the summary, leaving out a line per variable")
+	SyncCmd.Flags().Bool("quiet", false, "Disable the spinner and print plain start and end lines")
+	SyncCmd.Flags().Bool("check-limits", false, "Warn before syncing when a target scope would exceed GitHub's variable limits")
+	SyncCmd.Flags().Bool("strict-limits", false, "Fail before syncing when a target scope would exceed GitHub's variable limits")
+	SyncCmd.Flags().String("only-names", "", "Sync only these variables: comma-separated names, or a regular expression between slashes such as /^DB_/ (optional)")
+	SyncCmd.Flags().Bool("only-missing", false, "Create only variables that don't already exist in the target, leaving existing ones untouched")
+	SyncCmd.Flags().Bool("create-missing-environments", false, "Create deployment environments that don't exist in the target repository before adding their variables")
+	SyncCmd.Flags().Bool("skip-org", false, "Skip organization variables and sync only repository and environment variables")
+	SyncCmd.Flags().Bool("warn-on-empty-value", false, "Warn about variables whose value is empty")
+	SyncCmd.Flags().Bool("strict-empty-values", false, "Fail variables whose value is empty instead of creating them")
+	SyncCmd.Flags().String("name-prefix", "", "Prefix added to every variable name before it is created (optional)")
+	SyncCmd.Flags().String("name-suffix", "", "Suffix added to every variable name before it is created (optional)")
+	SyncCmd.Flags().Bool("interpolate", false, "Render variable values as Go templates with the source and target organization and host")
+	SyncCmd.Flags().String("source-organization", "", "Source organization, available to --interpolate as {{.SourceOrg}} (optional)")
+	SyncCmd.Flags().String("source-hostname", "", "Source GitHub Enterprise Server hostname, available to --interpolate as {{.SourceHost}} (optional)")
+	SyncCmd.Flags().String("apply-plan", "", "Create the variables of a plan written by --dry-run with --report-file, instead of reading --file")
+	SyncCmd.Flags().Bool("dry-run", false, "Print the variables that would be created, with their final values, without creating them")
+	SyncCmd.Flags().Bool("diff-target", false, "With --dry-run, compare each variable with its current value in the target and show whether it would be created, updated, or unchanged")
+	SyncCmd.Flags().String("report-file", "", "Write a JSON report of the run to this file (optional)")
+	SyncCmd.Flags().Bool("summary-json", false, "Print the summary as a line of JSON on standard output, sending all other output to standard error")
 
 	// Bind flags to viper
 	viper.BindPFlag("GHMV_FILE", SyncCmd.Flags().Lookup("file"))
+	viper.BindPFlag("GHMV_INPUT_ENCODING", SyncCmd.Flags().Lookup("input-encoding"))
 	viper.BindPFlag("GHMV_TARGET_HOSTNAME", SyncCmd.Flags().Lookup("target-hostname"))
 	viper.BindPFlag("GHMV_TARGET_ORGANIZATION", SyncCmd.Flags().Lookup("target-organization"))
 	viper.BindPFlag("GHMV_TARGET_TOKEN", SyncCmd.Flags().Lookup("target-token"))
+	viper.BindPFlag("GHMV_TARGET_ORG_TOKEN", SyncCmd.Flags().Lookup("target-org-token"))
+	viper.BindPFlag("GHMV_TARGET_PROFILE", SyncCmd.Flags().Lookup("target-profile"))
+	viper.BindPFlag("GHMV_TARGET_TOKEN_FILE", SyncCmd.Flags().Lookup("target-token-file"))
+	viper.BindPFlag("GHMV_TARGET_TOKEN_COMMAND", SyncCmd.Flags().Lookup("target-token-command"))
+	viper.BindPFlag("GHMV_STRICT_SKIPS", SyncCmd.Flags().Lookup("strict-skips"))
+	viper.BindPFlag("GHMV_ERROR_FILE", SyncCmd.Flags().Lookup("error-file"))
+	viper.BindPFlag("GHMV_MAX_FAILURES", SyncCmd.Flags().Lookup("max-failures"))
+	viper.BindPFlag("GHMV_QUIET", SyncCmd.Flags().Lookup("quiet"))
+	viper.BindPFlag("GHMV_PROGRESS", SyncCmd.Flags().Lookup("progress"))
+	viper.BindPFlag("GHMV_VERBOSE", SyncCmd.Flags().Lookup("verbose"))
+	viper.BindPFlag("GHMV_CHECK_LIMITS", SyncCmd.Flags().Lookup("check-limits"))
+	viper.BindPFlag("GHMV_STRICT_LIMITS", SyncCmd.Flags().Lookup("strict-limits"))
+	viper.BindPFlag("GHMV_ONLY_MISSING", SyncCmd.Flags().Lookup("only-missing"))
+	viper.BindPFlag("GHMV_ONLY_NAMES", SyncCmd.Flags().Lookup("only-names"))
+	viper.BindPFlag("GHMV_SKIP_ORG", SyncCmd.Flags().Lookup("skip-org"))
+	viper.BindPFlag("GHMV_CREATE_MISSING_ENVIRONMENTS", SyncCmd.Flags().Lookup("create-missing-environments"))
+	viper.BindPFlag("GHMV_NAME_PREFIX", SyncCmd.Flags().Lookup("name-prefix"))
+	viper.BindPFlag("GHMV_NAME_SUFFIX", SyncCmd.Flags().Lookup("name-suffix"))
+	viper.BindPFlag("GHMV_INTERPOLATE", SyncCmd.Flags().Lookup("interpolate"))
+	viper.BindPFlag("GHMV_DRY_RUN", SyncCmd.Flags().Lookup("dry-run"))
+	viper.BindPFlag("GHMV_DIFF_TARGET", SyncCmd.Flags().Lookup("diff-target"))
+	viper.BindPFlag("GHMV_APPLY_PLAN", SyncCmd.Flags().Lookup("apply-plan"))
 }
@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mona-actions/gh-migrate-variables/pkg/validate"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var ValidateCmd = &cobra.Command{
+	Use:   "validate <file>",
+	Short: "Check a variables CSV file before syncing it",
+	Long:  "Check a variables CSV file before syncing it, reporting header problems, invalid names and visibilities, duplicates, and oversized values with their line numbers. Exits non-zero when problems are found.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		viper.Set("GHMV_VALIDATE_FILE", args[0])
+
+		if err := validate.ValidateVariables(); err != nil {
+			fmt.Printf("failed to validate variables: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
@@ -2,10 +2,19 @@ package api
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/go-github/v66/github"
@@ -18,6 +27,10 @@ type ProxyConfig struct {
 	HTTPProxy  string
 	HTTPSProxy string
 	NoProxy    string
+
+	// Credentials for proxies whose URL doesn't carry its own user:pass
+	ProxyUser     string
+	ProxyPassword string
 }
 
 type GitHubClientConfig struct {
@@ -25,20 +38,93 @@ type GitHubClientConfig struct {
 	Hostname string
 }
 
+type RepositoryListConfig struct {
+	Sort string
+
+	// Lists the repositories of a user account rather than an organization
+	UserAccount bool
+
+	// Lists only the repositories this team has access to, by team slug
+	Team string
+}
+
+// Repository holds the repository attributes collected while listing an organization
+type Repository struct {
+	Name          string
+	DefaultBranch string
+	Visibility    string
+	Topics        []string
+}
+
 const (
 	defaultVariableVisibility = "private"
 	EntityTypeOrg             = "organization"
 	EntityTypeRepository      = "repository"
+	EntityTypeEnvironment     = "environment"
+	VisibilitySelected        = "selected"
+
+	// Account types reported for a repository owner
+	OwnerTypeOrganization = "Organization"
+	OwnerTypeUser         = "User"
+
+	// Separator used to join selected repository names into a single CSV column
+	SelectedRepositoriesSeparator = ";"
+
+	// GitHub rejects variable values larger than 48 KB
+	MaxVariableValueSize = 48 * 1024
+
+	// Largest file accepted by DownloadFile
+	maxDownloadSize = 50 * 1024 * 1024
 )
 
-// Helper function to create a consistent API context with a timeout
-func createAPITimeoutContext() (context.Context, context.CancelFunc) {
-	return context.WithTimeout(context.Background(), 30*time.Second)
+// Returned when an organization doesn't exist or the token can't access it
+var ErrOrganizationNotAccessible = errors.New("not found or not accessible with this token")
+
+// Returned when GitHub Actions is disabled for a repository, so it has no variables to list
+var ErrActionsDisabled = errors.New("GitHub Actions is disabled for this repository")
+
+// Returned when a variable value exceeds GitHub's size limit
+var ErrVariableValueTooLarge = errors.New("variable value exceeds GitHub's size limit")
+
+// Returned when the token can read a repository but isn't allowed to write its variables
+var ErrRepositoryReadOnly = errors.New("token can read the repository but not write its variables")
+
+// Returned along with the repositories listed so far when listing fails partway through
+var ErrRepositoryListIncomplete = errors.New("repository list is incomplete")
+
+// Returned when the primary rate limit is exhausted and only resets after the operation would time out,
+// so waiting for it is pointless and every further call would fail the same way
+type RateLimitExhaustedError struct {
+	// When GitHub resets the rate limit
+	Reset time.Time
+
+	// Error of the rate-limited call
+	Err error
+}
+
+func (e *RateLimitExhaustedError) Error() string {
+	return fmt.Sprintf("GitHub API rate limit exhausted until %s (in %v); re-run after that time, or lower the concurrency so fewer calls are made at once: %v",
+		e.Reset.UTC().Format(time.RFC3339), time.Until(e.Reset).Round(time.Second), e.Err)
 }
 
-// Helper function to create a longer-lived context for retry operations
-func createLongLivedContext() (context.Context, context.CancelFunc) {
-	return context.WithTimeout(context.Background(), 5*time.Minute)
+func (e *RateLimitExhaustedError) Unwrap() error {
+	return e.Err
+}
+
+// Sort orders supported by the organization repository listing API
+var RepositorySortOptions = []string{"full_name", "created", "updated", "pushed"}
+
+// Visibilities an organization variable can have
+var OrgVisibilityOptions = []string{"all", "private", VisibilitySelected}
+
+// Helper function to create a consistent API context with a timeout, cancelled along with the caller's context
+func createAPITimeoutContext(parent context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(parent, 30*time.Second)
+}
+
+// Helper function to create a longer-lived context for retry operations, extended by the longest time spent waiting for rate limits
+func createLongLivedContext(parent context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(parent, 5*time.Minute+rateLimitMaxWait*time.Duration(rateLimitRetryMax))
 }
 
 // Helper function to handle optional hostname parameter
@@ -53,35 +139,345 @@ func extractHostname(hostname ...string) string {
 func buildProxyFunction(proxyConfig *ProxyConfig) func(*http.Request) (*url.URL, error) {
 	return func(req *http.Request) (*url.URL, error) {
 		// Check if the request host should bypass the proxy based on NoProxy settings
-		if proxyConfig != nil && proxyConfig.NoProxy != "" {
-			noProxyURLs := strings.Split(proxyConfig.NoProxy, ",")
-			reqHost := req.URL.Host
-			for _, noProxy := range noProxyURLs {
-				if strings.TrimSpace(noProxy) == reqHost {
-					return nil, nil
-				}
-			}
+		if proxyConfig != nil && proxyConfig.NoProxy != "" && bypassesProxy(req.URL, proxyConfig.NoProxy) {
+			return nil, nil
 		}
 		// Determine the appropriate proxy URL based on the scheme (http or https)
 		if proxyConfig != nil {
 			if req.URL.Scheme == "https" && proxyConfig.HTTPSProxy != "" {
-				return url.Parse(proxyConfig.HTTPSProxy)
+				return parseProxyURL(proxyConfig.HTTPSProxy, proxyConfig)
 			}
 			if req.URL.Scheme == "http" && proxyConfig.HTTPProxy != "" {
-				return url.Parse(proxyConfig.HTTPProxy)
+				return parseProxyURL(proxyConfig.HTTPProxy, proxyConfig)
 			}
 		}
 		return nil, nil
 	}
 }
 
+// Ports requests go to when their URL doesn't name one
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// Reports whether a request to the URL bypasses the proxy, following the NO_PROXY rules of Go's httpproxy package.
+// Entries are comma-separated: "*" matches every host, a CIDR range or IP address matches IP hosts, and a domain
+// matches itself and its subdomains, or only its subdomains when written as .example.com or *.example.com.
+// Hosts are compared case-insensitively, and an entry only matches a port when it names one.
+func bypassesProxy(requestURL *url.URL, noProxy string) bool {
+	host := strings.TrimSuffix(strings.ToLower(requestURL.Hostname()), ".")
+	port := requestURL.Port()
+	if port == "" {
+		port = defaultPorts[requestURL.Scheme]
+	}
+	ip := net.ParseIP(host)
+
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+			continue
+		case entry == "*":
+			return true
+		}
+
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+
+		entryHost, entryPort := entry, ""
+		if splitHost, splitPort, err := net.SplitHostPort(entry); err == nil {
+			entryHost, entryPort = splitHost, splitPort
+		}
+		if entryPort != "" && entryPort != port {
+			continue
+		}
+		entryHost = strings.TrimSuffix(strings.Trim(entryHost, "[]"), ".")
+
+		if entryIP := net.ParseIP(entryHost); entryIP != nil {
+			if ip != nil && entryIP.Equal(ip) {
+				return true
+			}
+			continue
+		}
+
+		subdomainsOnly := strings.HasPrefix(entryHost, ".") || strings.HasPrefix(entryHost, "*.")
+		domain := strings.TrimPrefix(strings.TrimPrefix(entryHost, "*"), ".")
+		if domain == "" {
+			continue
+		}
+		if strings.HasSuffix(host, "."+domain) || (!subdomainsOnly && host == domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parses a proxy URL, adding the configured credentials when the URL has none of its own.
+// The transport sends a proxy URL's credentials as a Proxy-Authorization header, both on plain HTTP
+// requests and on the CONNECT request that opens an HTTPS tunnel.
+func parseProxyURL(rawURL string, proxyConfig *ProxyConfig) (*url.URL, error) {
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	if proxyURL.User == nil && proxyConfig.ProxyUser != "" {
+		proxyURL.User = url.UserPassword(proxyConfig.ProxyUser, proxyConfig.ProxyPassword)
+	}
+	return proxyURL, nil
+}
+
 // Retrieves proxy configuration from environment variables
 func loadProxyConfigFromEnv() *ProxyConfig {
 	return &ProxyConfig{
 		HTTPProxy:  viper.GetString("HTTP_PROXY"),
 		HTTPSProxy: viper.GetString("HTTPS_PROXY"),
 		NoProxy:    viper.GetString("NO_PROXY"),
+
+		ProxyUser:     viper.GetString("GHMV_PROXY_USER"),
+		ProxyPassword: viper.GetString("GHMV_PROXY_PASSWORD"),
+	}
+}
+
+// Adds a fixed set of headers to every outbound request
+type headerTransport struct {
+	base    http.RoundTripper
+	headers http.Header
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Clone the request so the caller's copy isn't mutated
+	req = req.Clone(req.Context())
+	// Replace any default value for the key, keeping every value given for a repeated key
+	for key, values := range t.headers {
+		req.Header.Del(key)
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+// Header GitHub returns with the ID it gave a request, which GitHub Support asks for when investigating a failure
+const requestIDHeader = "X-GitHub-Request-Id"
+
+// Logs the method, URL, status, GitHub request ID, and duration of every outbound request, never other headers or bodies
+type debugTransport struct {
+	base http.RoundTripper
+	log  *debugLog
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	outcome := "error: " + fmt.Sprint(err)
+	if err == nil {
+		outcome = resp.Status
+		if id := resp.Header.Get(requestIDHeader); id != "" {
+			outcome += " request-id=" + id
+		}
+	}
+	t.log.printf("%s %s %s %s %v\n", start.UTC().Format(time.RFC3339Nano), req.Method, req.URL, outcome, time.Since(start).Round(time.Millisecond))
+	return resp, err
+}
+
+// Debug log shared by every client, as requests from concurrent workers go to the same file
+type debugLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func (l *debugLog) printf(format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(l.file, format, args...)
+}
+
+var (
+	debugLogOnce sync.Once
+	debugLogFile *debugLog
+	debugLogErr  error
+)
+
+// Opens the HTTP debug log named in configuration once per run, returning nil when none is requested
+func openDebugLogFromEnv() (*debugLog, error) {
+	path := viper.GetString("GHMV_DEBUG_HTTP_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	debugLogOnce.Do(func() {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			debugLogErr = fmt.Errorf("cannot create HTTP debug file %s: %w", path, err)
+			return
+		}
+		debugLogFile = &debugLog{file: file}
+	})
+	return debugLogFile, debugLogErr
+}
+
+// Headers the tool sets itself, which a custom header would override: Authorization carries the GitHub token,
+// and Host is taken from the request URL rather than its headers
+var reservedHeaders = []string{"Authorization", "Host"}
+
+// Retrieves custom request headers, given as key=value pairs, from configuration
+func loadCustomHeadersFromEnv() (http.Header, error) {
+	headers := http.Header{}
+	for _, entry := range viper.GetStringSlice("GHMV_HEADER") {
+		key, value, found := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid header %q: expected key=value", entry)
+		}
+		if slices.Contains(reservedHeaders, http.CanonicalHeaderKey(key)) {
+			return nil, fmt.Errorf("invalid header %q: %s can't be set with --header", entry, http.CanonicalHeaderKey(key))
+		}
+		headers.Add(key, strings.TrimSpace(value))
+	}
+	return headers, nil
+}
+
+// TLS versions that can be required with --min-tls-version
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Returns the TLS version of the given name, such as 1.2, or TLS 1.2 when the name is empty
+func parseTLSVersion(name string) (uint16, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return tls.VersionTLS12, nil
+	}
+	version, ok := tlsVersions[name]
+	if !ok {
+		return 0, fmt.Errorf("invalid minimum TLS version %q: must be one of 1.0, 1.1, 1.2, or 1.3", name)
+	}
+	return version, nil
+}
+
+// Builds the TLS configuration from the optional CA bundle, minimum TLS version, and verification settings
+func loadTLSConfigFromEnv() (*tls.Config, error) {
+	// Connections that negotiate an older version than the minimum are refused during the handshake
+	minVersion, err := parseTLSVersion(viper.GetString("GHMV_MIN_TLS_VERSION"))
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:         minVersion,
+		InsecureSkipVerify: viper.GetBool("GHMV_INSECURE_SKIP_VERIFY"),
+	}
+
+	// Trust an additional CA bundle on top of the system trust store
+	if caCertFile := viper.GetString("GHMV_CA_CERT"); caCertFile != "" {
+		pem, err := os.ReadFile(caCertFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA certificate file %s: %w", caCertFile, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid PEM certificates found in %s", caCertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+// Downloads a file over HTTP or HTTPS, honoring the proxy and TLS configuration.
+// HTML responses, typically a login or error page, and files over 50 MB are rejected.
+func DownloadFile(fileURL string) ([]byte, error) {
+	return DownloadFileCtx(context.Background(), fileURL)
+}
+
+// Like DownloadFile, stopping when ctx is cancelled
+func DownloadFileCtx(ctx context.Context, fileURL string) ([]byte, error) {
+	tlsConfig, err := loadTLSConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{
+		Timeout: 2 * time.Minute,
+		Transport: &http.Transport{
+			Proxy:           buildProxyFunction(loadProxyConfigFromEnv()),
+			TLSClientConfig: tlsConfig,
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", fileURL, err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", fileURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", fileURL, resp.Status)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == "text/html" {
+		return nil, fmt.Errorf("failed to download %s: got an HTML page instead of a file", fileURL)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxDownloadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", fileURL, err)
 	}
+	if len(content) > maxDownloadSize {
+		return nil, fmt.Errorf("failed to download %s: file is larger than %d MB", fileURL, maxDownloadSize/(1024*1024))
+	}
+	return content, nil
+}
+
+// Connection pool of the shared transport
+var (
+	maxIdleConns    = 100
+	idleConnTimeout = 90 * time.Second
+)
+
+// Sets how many idle connections are kept open for reuse, and how long each may stay idle before it is closed,
+// or zero to keep it open indefinitely. Requests go to a single API host, so the limit applies to that host too.
+// Must be called before the first API call, as the transport is only built once.
+func SetConnectionPool(maxIdle int, idleTimeout time.Duration) {
+	maxIdleConns, idleConnTimeout = maxIdle, idleTimeout
+}
+
+// Transport shared by every client, so concurrent and successive API calls reuse connections instead of dialing anew
+var (
+	transportOnce   sync.Once
+	clientTransport *http.Transport
+	transportErr    error
+)
+
+// Returns the shared transport, building it with the proxy, TLS, and connection pool settings on first use
+func sharedTransport() (*http.Transport, error) {
+	transportOnce.Do(func() {
+		// Set up proxy configuration if available
+		proxyConfig := loadProxyConfigFromEnv()
+		tlsConfig, err := loadTLSConfigFromEnv()
+		if err != nil {
+			transportErr = err
+			return
+		}
+		clientTransport = &http.Transport{
+			Proxy:                 buildProxyFunction(proxyConfig),
+			TLSClientConfig:       tlsConfig,
+			ResponseHeaderTimeout: 10 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			MaxIdleConns:          maxIdleConns,
+			MaxIdleConnsPerHost:   maxIdleConns,
+			IdleConnTimeout:       idleConnTimeout,
+		}
+	})
+	return clientTransport, transportErr
 }
 
 // Creates a new GitHub client with optional proxy and enterprise hostname support
@@ -90,25 +486,49 @@ func initializeGitHubClient(config GitHubClientConfig) (*github.Client, error) {
 		return nil, fmt.Errorf("GitHub token is required")
 	}
 
-	// Create an OAuth2 HTTP client
+	// Create an OAuth2 HTTP client, whose token is replaced when it expires if it has a refresh command
 	ctx := context.Background()
-	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: config.Token})
+	var ts oauth2.TokenSource = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: config.Token})
+	refreshable := lookupRefreshableToken(config.Token)
+	if refreshable != nil {
+		ts = refreshable
+	}
+
+	transport, err := sharedTransport()
+	if err != nil {
+		return nil, err
+	}
 
-	// Set up proxy configuration if available
-	proxyConfig := loadProxyConfigFromEnv()
-	transport := &http.Transport{
-		Proxy:                 buildProxyFunction(proxyConfig),
-		ResponseHeaderTimeout: 10 * time.Second,
-		TLSHandshakeTimeout:   10 * time.Second,
-		IdleConnTimeout:       10 * time.Second,
+	// Inject any custom headers required by gateways in front of the API
+	headers, err := loadCustomHeadersFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	var base http.RoundTripper = transport
+	if len(headers) > 0 {
+		base = &headerTransport{base: transport, headers: headers}
+	}
+	// Tell an expired token from one that never worked when GitHub rejects it
+	base = &tokenValidationTransport{base: base}
+
+	// Record every exchange when diagnosing network issues
+	httpLog, err := openDebugLogFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if httpLog != nil {
+		base = &debugTransport{base: base, log: httpLog}
 	}
 
 	// Create an HTTP client with the configured transport
 	tc := oauth2.NewClient(ctx, ts)
 	tc.Transport = &oauth2.Transport{
-		Base:   transport,
+		Base:   base,
 		Source: ts,
 	}
+	if refreshable != nil {
+		tc.Transport = &tokenRefreshTransport{base: tc.Transport, token: refreshable}
+	}
 
 	// Create the GitHub client using the HTTP client
 	client := github.NewClient(tc)
@@ -128,60 +548,271 @@ func initializeGitHubClient(config GitHubClientConfig) (*github.Client, error) {
 	return client, nil
 }
 
-// Retries the given operation with a context, using an exponential backoff strategy
-func retryWithExponentialBackoff(ctx context.Context, operation func() error) error {
-	// Retrieve the maximum number of retries from configuration, defaulting to 3 if not set
-	maxRetries := viper.GetInt("RETRY_MAX")
-	if maxRetries <= 0 {
-		maxRetries = 3
+// Retry policy applied to every API call
+var (
+	retryMax   = 3
+	retryDelay = time.Second
+
+	// Transient network errors, such as dropped connections and gateway errors, which usually clear up quickly
+	networkRetryMax   = 3
+	networkRetryDelay = time.Second
+
+	// Rate-limit errors, which only clear up once the limit resets. Without a maximum wait they back off from retryDelay.
+	rateLimitRetryMax = 3
+	rateLimitMaxWait  time.Duration
+
+	// HTTP status codes that are retried, or nil to retry every failed call
+	retryStatusCodes map[int]bool
+)
+
+// Largest page GitHub serves when listing repositories, variables, and environments
+const MaxPageSize = 100
+
+// Number of items requested per page when listing
+var pageSize = MaxPageSize
+
+// Sets the number of items requested per page when listing, between 1 and MaxPageSize
+func SetPageSize(size int) {
+	pageSize = size
+}
+
+// Sets the maximum attempts for each API call and the delay before the first retry, for every class of error
+func SetRetryPolicy(maxAttempts int, delay time.Duration) {
+	retryMax, retryDelay = maxAttempts, delay
+	networkRetryMax, networkRetryDelay = maxAttempts, delay
+	rateLimitRetryMax, rateLimitMaxWait = maxAttempts, 0
+}
+
+// Sets the maximum attempts and the delay before the first retry for transient network errors
+func SetNetworkRetryPolicy(maxAttempts int, delay time.Duration) {
+	networkRetryMax, networkRetryDelay = maxAttempts, delay
+}
+
+// Sets the maximum attempts for rate-limit errors, and the longest wait for a rate limit to reset before each retry
+func SetRateLimitRetryPolicy(maxAttempts int, maxWait time.Duration) {
+	rateLimitRetryMax, rateLimitMaxWait = maxAttempts, maxWait
+}
+
+// Limits retries of failed calls with an HTTP response to the given status codes, or retries every failed call
+// when there are none. Calls that got no response, such as dropped connections, are always retried.
+func SetRetryStatusCodes(codes []int) {
+	retryStatusCodes = nil
+	if len(codes) == 0 {
+		return
 	}
+	retryStatusCodes = make(map[int]bool, len(codes))
+	for _, code := range codes {
+		retryStatusCodes[code] = true
+	}
+}
 
-	// Retrieve the retry delay from configuration, defaulting to 1 second if not set
-	retryDelay, err := time.ParseDuration(viper.GetString("RETRY_DELAY"))
-	if err != nil {
-		retryDelay = time.Second
+// Returns the response of a failed API call, or nil when the call got no response
+func errorResponse(err error) *http.Response {
+	var response *http.Response
+	var rateLimitErr *github.RateLimitError
+	var abuseErr *github.AbuseRateLimitError
+	var errResp *github.ErrorResponse
+	switch {
+	case errors.As(err, &rateLimitErr):
+		response = rateLimitErr.Response
+	case errors.As(err, &abuseErr):
+		response = abuseErr.Response
+	case errors.As(err, &errResp):
+		response = errResp.Response
 	}
+	return response
+}
+
+// Returns the HTTP status code of a failed API call, or zero when the call got no response
+func errorStatusCode(err error) int {
+	response := errorResponse(err)
+	if response == nil {
+		return 0
+	}
+	return response.StatusCode
+}
+
+// Returns " (request ID <id>)" for a failed API call whose response carries GitHub's request ID, or an empty string,
+// so the ID can be appended to error messages and quoted to GitHub Support
+func requestIDSuffix(err error) string {
+	response := errorResponse(err)
+	if response == nil {
+		return ""
+	}
+	if id := response.Header.Get(requestIDHeader); id != "" {
+		return fmt.Sprintf(" (request ID %s)", id)
+	}
+	return ""
+}
+
+// Reports whether a failed API call is retried, as its status code is one of the retried codes
+func isRetryable(err error) bool {
+	if retryStatusCodes == nil {
+		return true
+	}
+	status := errorStatusCode(err)
+	return status == 0 || retryStatusCodes[status]
+}
+
+// Classes of errors that are retried with their own policy
+type errorClass int
+
+const (
+	errorClassOther errorClass = iota
+	errorClassNetwork
+	errorClassRateLimit
+)
+
+// Classifies an error from an API call to choose its retry policy
+func classifyError(err error) errorClass {
+	var rateLimitErr *github.RateLimitError
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &rateLimitErr) || errors.As(err, &abuseErr) {
+		return errorClassRateLimit
+	}
+
+	var errResp *github.ErrorResponse
+	if errors.As(err, &errResp) && errResp.Response != nil {
+		switch errResp.Response.StatusCode {
+		case http.StatusTooManyRequests:
+			return errorClassRateLimit
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return errorClassNetwork
+		}
+		return errorClassOther
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return errorClassNetwork
+	}
+	return errorClassOther
+}
+
+// Returns how long GitHub asked to wait before retrying a rate-limited call, or zero when it didn't say
+func rateLimitReset(err error) time.Duration {
+	var rateLimitErr *github.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		return time.Until(rateLimitErr.Rate.Reset.Time)
+	}
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) && abuseErr.RetryAfter != nil {
+		return *abuseErr.RetryAfter
+	}
+	return 0
+}
+
+// Returns a RateLimitExhaustedError when a call failed because the primary rate limit is used up
+// and it resets after the context's deadline, or nil when retrying may still succeed in time
+func rateLimitExhausted(ctx context.Context, err error) error {
+	var rateLimitErr *github.RateLimitError
+	if !errors.As(err, &rateLimitErr) || rateLimitErr.Rate.Remaining > 0 {
+		return nil
+	}
+	reset := rateLimitErr.Rate.Reset.Time
+	if deadline, ok := ctx.Deadline(); !ok || !reset.After(deadline) {
+		return nil
+	}
+	return &RateLimitExhaustedError{Reset: reset, Err: err}
+}
+
+// Returns the maximum attempts for an error's class, and how long to wait after the given attempt of that class failed
+func retryPolicyFor(class errorClass, attempt int, err error) (int, time.Duration) {
+	backoff := time.Duration(1 << uint(attempt-1))
+	switch class {
+	case errorClassNetwork:
+		return networkRetryMax, networkRetryDelay * backoff
+	case errorClassRateLimit:
+		waitTime := retryDelay * backoff
+		if rateLimitMaxWait > 0 {
+			if reset := rateLimitReset(err); reset > 0 {
+				waitTime = reset
+			}
+			waitTime = min(waitTime, rateLimitMaxWait)
+		}
+		return rateLimitRetryMax, waitTime
+	default:
+		return retryMax, retryDelay * backoff
+	}
+}
+
+// Retries the given operation with a context, using an exponential backoff strategy.
+// Each class of error is retried under its own policy, counting only the attempts that failed with that class.
+func retryWithExponentialBackoff(ctx context.Context, operation func() error) error {
+	failures := make(map[errorClass]int)
 
-	var lastErr error
 	// Attempt the operation, retrying with exponential backoff if it fails
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		if err := operation(); err == nil {
+	for attempt := 1; ; attempt++ {
+		err := operation()
+		if err == nil {
 			// If the operation succeeds, return nil
 			return nil
-		} else {
-			lastErr = err
-			// If the operation fails and more retries are allowed, wait before retrying
-			if attempt < maxRetries {
-				waitTime := retryDelay * time.Duration(1<<uint(attempt-1))
-				pterm.Warning.Printf("Attempt %d failed, retrying in %v: %v\n", attempt, waitTime, lastErr)
-
-				// select waits for either context cancellation or the backoff timer to expire
-				select {
-				// Handles context cancellation (timeout, deadline, or explicit cancel)
-				case <-ctx.Done():
-					return fmt.Errorf("operation cancelled: %w", ctx.Err())
-
-				// Waits for backoff duration before retrying the operation
-				case <-time.After(waitTime):
-					continue
-				}
-			}
+		}
+		// A cancelled caller gets no further attempts
+		if ctx.Err() != nil {
+			return fmt.Errorf("operation cancelled: %w", ctx.Err())
+		}
+
+		// A rate limit that resets only after the deadline can't be waited out, so say when to come back instead of timing out
+		if exhausted := rateLimitExhausted(ctx, err); exhausted != nil {
+			return exhausted
+		}
+
+		// A rejected token stays rejected, as it was already refreshed if it could be, so every remaining call would fail too
+		if errorStatusCode(err) == http.StatusUnauthorized {
+			return fmt.Errorf("%w%s: %w", tokenRejectedError(err), requestIDSuffix(err), err)
+		}
+
+		// Only the chosen status codes are retried, each still under the policy of its class
+		if !isRetryable(err) {
+			return fmt.Errorf("operation failed with status %d, which is not retried%s: %w", errorStatusCode(err), requestIDSuffix(err), err)
+		}
+
+		class := classifyError(err)
+		failures[class]++
+		maxAttempts, waitTime := retryPolicyFor(class, failures[class], err)
+		// If all attempts of this class fail, return the last encountered error
+		if failures[class] >= maxAttempts {
+			return fmt.Errorf("operation failed after %d attempts%s: %w", attempt, requestIDSuffix(err), err)
+		}
+		pterm.Warning.Printf("Attempt %d failed%s, retrying in %v: %v\n", attempt, requestIDSuffix(err), waitTime, err)
+
+		// select waits for either context cancellation or the backoff timer to expire
+		select {
+		// Handles context cancellation (timeout, deadline, or explicit cancel)
+		case <-ctx.Done():
+			return fmt.Errorf("operation cancelled: %w", ctx.Err())
+
+		// Waits for backoff duration before retrying the operation
+		case <-time.After(waitTime):
 		}
 	}
-	// If all attempts fail, return the last encountered error
-	return fmt.Errorf("operation failed after %d attempts: %w", maxRetries, lastErr)
 }
 
-// Wrapper function to retry an operation with a default context
-func retryWithDefaultContext(operation func() error) error {
+// Wrapper function to retry an operation within the caller's context
+func retryWithContext(parent context.Context, operation func() error) error {
 	// Create a longer-lived context for retries
-	ctx, cancel := createLongLivedContext()
+	ctx, cancel := createLongLivedContext(parent)
 	// Retry the operation using the created context
 	err := retryWithExponentialBackoff(ctx, operation)
 	cancel()
 	return err
 }
 
+// Reports whether an API error says GitHub Actions is disabled for the repository
+func isActionsDisabled(err error) bool {
+	var errResp *github.ErrorResponse
+	if !errors.As(err, &errResp) || errResp.Response == nil {
+		return false
+	}
+	switch errResp.Response.StatusCode {
+	case http.StatusForbidden, http.StatusNotFound, http.StatusConflict:
+		message := strings.ToLower(errResp.Message)
+		return strings.Contains(message, "actions") && strings.Contains(message, "disabled")
+	}
+	return false
+}
+
 // Parses a GitHub Actions variable into a map representation
 func parseGitHubVariable(variable *github.ActionsVariable, scope string) map[string]string {
 	// Return nil if the variable is nil or has no name
@@ -195,26 +826,41 @@ func parseGitHubVariable(variable *github.ActionsVariable, scope string) map[str
 		"Value": variable.Value,
 		"Scope": scope,
 	}
-	// Set the visibility to the provided value or use the default visibility if not set
+	// Set the visibility to the provided value or use the default visibility if not set. An organization variable's
+	// visibility decides which repositories can use it, so a missing one is left empty rather than guessed.
 	if variable.Visibility != nil {
 		parsedVar["Visibility"] = *variable.Visibility
-	} else {
+	} else if scope != EntityTypeOrg {
 		parsedVar["Visibility"] = defaultVariableVisibility
 	}
+	// Timestamps are the only other fields the API returns; the selected repositories URL is resolved separately
+	if variable.CreatedAt != nil {
+		parsedVar["CreatedAt"] = variable.CreatedAt.UTC().Format(time.RFC3339)
+	}
+	if variable.UpdatedAt != nil {
+		parsedVar["UpdatedAt"] = variable.UpdatedAt.UTC().Format(time.RFC3339)
+	}
 
 	return parsedVar
 }
 
-// Retrieves variables from a GitHub organization or repository
-func fetchGitHubVariables(entityType, org, repo, token string, hostname ...string) ([]map[string]string, error) {
+// Reports how many variables have been fetched so far out of the total, as each page arrives
+type FetchProgress func(fetched, total int)
+
+// Retrieves variables from a GitHub organization, repository, or environment, reporting progress if given
+func fetchGitHubVariables(ctx context.Context, entityType, org, repo, env, token string, progress FetchProgress, hostname ...string) ([]map[string]string, error) {
 	// Validate that the organization name is provided
 	if org == "" {
 		return nil, fmt.Errorf("organization name is required")
 	}
-	// Validate that the repository name is provided for repository-level variables
-	if entityType == EntityTypeRepository && repo == "" {
+	// Validate that the repository name is provided for repository and environment variables
+	if entityType != EntityTypeOrg && repo == "" {
 		return nil, fmt.Errorf("repository name is required")
 	}
+	// Validate that the environment name is provided for environment variables
+	if entityType == EntityTypeEnvironment && env == "" {
+		return nil, fmt.Errorf("environment name is required")
+	}
 
 	// Initialize a new GitHub client
 	client, err := initializeGitHubClient(GitHubClientConfig{Token: token, Hostname: extractHostname(hostname...)})
@@ -222,74 +868,275 @@ func fetchGitHubVariables(entityType, org, repo, token string, hostname ...strin
 		return nil, fmt.Errorf("failed to initialize GitHub client: %w", err)
 	}
 
-	var variables *github.ActionsVariables
-	// Retry the variable retrieval operation
-	err = retryWithDefaultContext(func() error {
-		ctx, cancel := createAPITimeoutContext()
-		defer cancel()
-		var apiErr error
+	opts := &github.ListOptions{PerPage: pageSize}
+	var allVariables []*github.ActionsVariable
 
-		// Retrieve variables based on entity type (organization or repository)
-		if entityType == EntityTypeOrg {
-			variables, _, apiErr = client.Actions.ListOrgVariables(ctx, org, nil)
-		} else {
-			variables, _, apiErr = client.Actions.ListRepoVariables(ctx, org, repo, nil)
+	// Iterate through pages of results
+	for {
+		var variables *github.ActionsVariables
+		var resp *github.Response
+		var actionsDisabled bool
+		// Retry the variable retrieval operation
+		err = retryWithContext(ctx, func() error {
+			ctx, cancel := createAPITimeoutContext(ctx)
+			defer cancel()
+			var apiErr error
+
+			// Retrieve variables based on entity type (organization, repository, or environment)
+			switch entityType {
+			case EntityTypeOrg:
+				variables, resp, apiErr = client.Actions.ListOrgVariables(ctx, org, opts)
+			case EntityTypeEnvironment:
+				variables, resp, apiErr = client.Actions.ListEnvVariables(ctx, org, repo, env, opts)
+			default:
+				variables, resp, apiErr = client.Actions.ListRepoVariables(ctx, org, repo, opts)
+			}
+			// Actions being disabled is a definitive answer, so return it without retrying
+			if isActionsDisabled(apiErr) {
+				actionsDisabled = true
+				return nil
+			}
+			return apiErr
+		})
+
+		// Handle any errors from the variable retrieval process
+		if actionsDisabled {
+			return nil, fmt.Errorf("repository %s: %w", repo, ErrActionsDisabled)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch %s variables: %w", entityType, err)
 		}
-		return apiErr
-	})
 
-	// Handle any errors from the variable retrieval process
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch %s variables: %w", entityType, err)
-	}
+		if variables == nil {
+			return nil, fmt.Errorf("no variables data returned for %s %s", entityType, org)
+		}
+		allVariables = append(allVariables, variables.Variables...)
+		if progress != nil {
+			progress(len(allVariables), variables.TotalCount)
+		}
 
-	if variables == nil {
-		return nil, fmt.Errorf("no variables data returned for %s %s", entityType, org)
+		// If there are no more pages, break the loop
+		if resp == nil || resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
 	}
 
 	// Parse and collect the variables into a slice of maps
 	var parsedVariables []map[string]string
 	scope := entityType
-	if entityType == EntityTypeRepository {
+	if entityType != EntityTypeOrg {
 		scope = repo
 	}
 
-	for _, variable := range variables.Variables {
+	for _, variable := range allVariables {
 		parsedVar := parseGitHubVariable(variable, scope)
-		if parsedVar != nil {
-			parsedVariables = append(parsedVariables, parsedVar)
+		if parsedVar == nil {
+			continue
+		}
+		if entityType == EntityTypeOrg && parsedVar["Visibility"] == "" {
+			pterm.Warning.Printf("GitHub returned no visibility for organization variable %s, so it is exported without one\n", variable.Name)
+		}
+		if entityType == EntityTypeEnvironment {
+			parsedVar["Environment"] = env
 		}
+
+		// Record selected repositories by name so they can be re-resolved in another organization. Without them the
+		// variable would be written with an empty selection, and sync would recreate it visible to no repository.
+		if entityType == EntityTypeOrg && parsedVar["Visibility"] == VisibilitySelected {
+			names, err := fetchSelectedRepositoryNames(ctx, client, org, variable.Name)
+			if err != nil {
+				return nil, fmt.Errorf("failed to fetch selected repositories for variable %s: %w", variable.Name, err)
+			}
+			parsedVar["SelectedRepositories"] = strings.Join(names, SelectedRepositoriesSeparator)
+		}
+		parsedVariables = append(parsedVariables, parsedVar)
 	}
 
 	return parsedVariables, nil
 }
 
+// Retrieves the names of the repositories selected for an organization variable
+func fetchSelectedRepositoryNames(ctx context.Context, client *github.Client, org, name string) ([]string, error) {
+	opts := &github.ListOptions{PerPage: pageSize}
+	var names []string
+
+	// Iterate through pages of results so no selected repository is dropped
+	for {
+		var selected *github.SelectedReposList
+		var resp *github.Response
+		err := retryWithContext(ctx, func() error {
+			ctx, cancel := createAPITimeoutContext(ctx)
+			defer cancel()
+			var apiErr error
+			selected, resp, apiErr = client.Actions.ListSelectedReposForOrgVariable(ctx, org, name, opts)
+			return apiErr
+		})
+		if err != nil {
+			return nil, err
+		}
+		if selected == nil {
+			return nil, fmt.Errorf("no data returned")
+		}
+
+		for _, repo := range selected.Repositories {
+			if repo != nil && repo.Name != nil {
+				names = append(names, *repo.Name)
+			}
+		}
+
+		// If there are no more pages, break the loop
+		if resp == nil || resp.NextPage == 0 {
+			break
+		}
+		// Move to the next page
+		opts.Page = resp.NextPage
+	}
+	return names, nil
+}
+
+// Resolves repository names to their IDs in the given organization, dropping repositories that don't exist.
+// Any other failure is returned, as dropping the repository would silently narrow the variable's selection.
+func resolveRepositoryIDs(ctx context.Context, client *github.Client, org string, names []string) (github.SelectedRepoIDs, error) {
+	ids := github.SelectedRepoIDs{}
+	for _, name := range names {
+		var repo *github.Repository
+		var resp *github.Response
+		err := retryWithContext(ctx, func() error {
+			ctx, cancel := createAPITimeoutContext(ctx)
+			defer cancel()
+			var apiErr error
+			repo, resp, apiErr = client.Repositories.Get(ctx, org, name)
+			// A 404 is a definitive answer, so return it without retrying
+			if resp != nil && resp.StatusCode == http.StatusNotFound {
+				return nil
+			}
+			return apiErr
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve selected repository %s: %w", name, err)
+		}
+		if resp.StatusCode == http.StatusNotFound || repo == nil || repo.ID == nil {
+			pterm.Warning.Printf("Selected repository %s not found in organization %s, dropping it from the selection\n", name, org)
+			continue
+		}
+		ids = append(ids, *repo.ID)
+	}
+	return ids, nil
+}
+
 // Retrieves organization-level variables from GitHub
 func FetchOrgVariables(org, token string, hostname ...string) ([]map[string]string, error) {
+	return FetchOrgVariablesCtx(context.Background(), org, token, hostname...)
+}
+
+// Like FetchOrgVariables, stopping when ctx is cancelled
+func FetchOrgVariablesCtx(ctx context.Context, org, token string, hostname ...string) ([]map[string]string, error) {
 	// Calls fetchGitHubVariables for organization-level variables
-	return fetchGitHubVariables(EntityTypeOrg, org, "", token, hostname...)
+	return fetchGitHubVariables(ctx, EntityTypeOrg, org, "", "", token, nil, hostname...)
+}
+
+// Retrieves organization-level variables from GitHub, reporting progress as pages are fetched
+func FetchOrgVariablesWithProgress(org, token string, progress FetchProgress, hostname ...string) ([]map[string]string, error) {
+	return FetchOrgVariablesWithProgressCtx(context.Background(), org, token, progress, hostname...)
+}
+
+// Like FetchOrgVariablesWithProgress, stopping when ctx is cancelled
+func FetchOrgVariablesWithProgressCtx(ctx context.Context, org, token string, progress FetchProgress, hostname ...string) ([]map[string]string, error) {
+	return fetchGitHubVariables(ctx, EntityTypeOrg, org, "", "", token, progress, hostname...)
 }
 
 // Retrieves repository-level variables from GitHub
 func FetchRepoVariables(org, repo, token string, hostname ...string) ([]map[string]string, error) {
+	return FetchRepoVariablesCtx(context.Background(), org, repo, token, hostname...)
+}
+
+// Like FetchRepoVariables, stopping when ctx is cancelled
+func FetchRepoVariablesCtx(ctx context.Context, org, repo, token string, hostname ...string) ([]map[string]string, error) {
 	// Calls fetchGitHubVariables for repository-level variables
-	return fetchGitHubVariables(EntityTypeRepository, org, repo, token, hostname...)
+	return fetchGitHubVariables(ctx, EntityTypeRepository, org, repo, "", token, nil, hostname...)
+}
+
+// Retrieves environment-level variables from GitHub
+func FetchEnvVariables(org, repo, env, token string, hostname ...string) ([]map[string]string, error) {
+	return FetchEnvVariablesCtx(context.Background(), org, repo, env, token, hostname...)
 }
 
-// Creates a variable in a GitHub organization or repository
-func addGitHubVariable(entityType, org, repo, name, value, visibility, token string, hostname ...string) error {
+// Like FetchEnvVariables, stopping when ctx is cancelled
+func FetchEnvVariablesCtx(ctx context.Context, org, repo, env, token string, hostname ...string) ([]map[string]string, error) {
+	// Calls fetchGitHubVariables for environment-level variables
+	return fetchGitHubVariables(ctx, EntityTypeEnvironment, org, repo, env, token, nil, hostname...)
+}
+
+// Retrieves the names of all deployment environments in a repository
+func FetchRepoEnvironments(org, repo, token string, hostname ...string) ([]string, error) {
+	return FetchRepoEnvironmentsCtx(context.Background(), org, repo, token, hostname...)
+}
+
+// Like FetchRepoEnvironments, stopping when ctx is cancelled
+func FetchRepoEnvironmentsCtx(ctx context.Context, org, repo, token string, hostname ...string) ([]string, error) {
+	// Initialize a new GitHub client
+	client, err := initializeGitHubClient(GitHubClientConfig{Token: token, Hostname: extractHostname(hostname...)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize GitHub client: %w", err)
+	}
+
+	opts := &github.EnvironmentListOptions{ListOptions: github.ListOptions{PerPage: pageSize}}
+	var environments []string
+
+	// Iterate through pages of results
+	for {
+		var page *github.EnvResponse
+		var resp *github.Response
+		err := retryWithContext(ctx, func() error {
+			ctx, cancel := createAPITimeoutContext(ctx)
+			defer cancel()
+			var apiErr error
+			page, resp, apiErr = client.Repositories.ListEnvironments(ctx, org, repo, opts)
+			return apiErr
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch environments for %s: %w", repo, err)
+		}
+
+		for _, env := range page.Environments {
+			if env != nil && env.Name != nil {
+				environments = append(environments, *env.Name)
+			}
+		}
+
+		// If there are no more pages, break the loop
+		if resp == nil || resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return environments, nil
+}
+
+// Creates a variable in a GitHub organization, repository, or environment
+func addGitHubVariable(ctx context.Context, entityType, org, repo, env, name, value, visibility string, selectedRepos []string, token string, hostname ...string) error {
 	// Validate that the organization name and variable name are provided
 	if org == "" || name == "" {
 		return fmt.Errorf("organization name and variable name are required")
 	}
-	// Validate that the repository name is provided for repository-level variables
-	if entityType == EntityTypeRepository && repo == "" {
+	// Validate that the repository name is provided for repository and environment variables
+	if entityType != EntityTypeOrg && repo == "" {
 		return fmt.Errorf("repository name is required")
 	}
+	// Validate that the environment name is provided for environment variables
+	if entityType == EntityTypeEnvironment && env == "" {
+		return fmt.Errorf("environment name is required")
+	}
+	// Reject values GitHub would refuse rather than issuing a doomed API call
+	if len(value) > MaxVariableValueSize {
+		return fmt.Errorf("%w: value is %d bytes, limit is %d bytes", ErrVariableValueTooLarge, len(value), MaxVariableValueSize)
+	}
 
-	// Check if the repository exists if creating a repo variable
-	if entityType == EntityTypeRepository {
-		exists, err := doesRepositoryExist(org, repo, token, hostname...)
+	// Check if the repository exists if creating a repo or environment variable
+	if entityType != EntityTypeOrg {
+		exists, err := doesRepositoryExist(ctx, org, repo, token, hostname...)
 		if err != nil {
 			return fmt.Errorf("failed to check repository existence: %w", err)
 		}
@@ -304,8 +1151,12 @@ func addGitHubVariable(entityType, org, repo, name, value, visibility, token str
 		return fmt.Errorf("failed to initialize GitHub client: %w", err)
 	}
 
-	// Set default visibility if not provided
+	// Set default visibility if not provided. Only repository and environment variables get one, as a default
+	// would change which repositories can use an organization variable.
 	if visibility == "" {
+		if entityType == EntityTypeOrg {
+			return fmt.Errorf("organization variable %s has no visibility: must be one of %s", name, strings.Join(OrgVisibilityOptions, ", "))
+		}
 		visibility = defaultVariableVisibility
 	}
 
@@ -316,22 +1167,38 @@ func addGitHubVariable(entityType, org, repo, name, value, visibility, token str
 		Visibility: github.String(visibility),
 	}
 
+	// Map selected repositories by name onto the target organization's repository IDs
+	if entityType == EntityTypeOrg && visibility == VisibilitySelected {
+		ids, err := resolveRepositoryIDs(ctx, client, org, selectedRepos)
+		if err != nil {
+			return fmt.Errorf("failed to create %s variable %s: %w", entityType, name, err)
+		}
+		variable.SelectedRepositoryIDs = &ids
+	}
+
 	// Retry the variable creation operation
-	err = retryWithDefaultContext(func() error {
-		ctx, cancel := createAPITimeoutContext()
+	err = retryWithContext(ctx, func() error {
+		ctx, cancel := createAPITimeoutContext(ctx)
 		defer cancel()
 
-		// Create the variable based on the entity type (organization or repository)
-		if entityType == EntityTypeOrg {
-			_, err := client.Actions.CreateOrgVariable(ctx, org, variable)
-			return err
+		// Create the variable based on the entity type (organization, repository, or environment)
+		switch entityType {
+		case EntityTypeOrg:
+			_, err = client.Actions.CreateOrgVariable(ctx, org, variable)
+		case EntityTypeEnvironment:
+			_, err = client.Actions.CreateEnvVariable(ctx, org, repo, env, variable)
+		default:
+			_, err = client.Actions.CreateRepoVariable(ctx, org, repo, variable)
 		}
-		_, err = client.Actions.CreateRepoVariable(ctx, org, repo, variable)
 		return err
 	})
 
-	// Handle any errors from the variable creation process
+	// Handle any errors from the variable creation process. The repository was found above, so a 403 that
+	// isn't a rate limit means the token can read it but lacks permission to write its variables.
 	if err != nil {
+		if entityType != EntityTypeOrg && errorStatusCode(err) == http.StatusForbidden && classifyError(err) != errorClassRateLimit {
+			return fmt.Errorf("failed to create %s variable %s: %w: %w", entityType, name, ErrRepositoryReadOnly, err)
+		}
 		return fmt.Errorf("failed to create %s variable %s: %w", entityType, name, err)
 	}
 
@@ -339,60 +1206,301 @@ func addGitHubVariable(entityType, org, repo, name, value, visibility, token str
 }
 
 // Creates an organization-level variable in GitHub
-func AddOrgVariable(org, name, value, visibility, token string, hostname ...string) error {
+func AddOrgVariable(org, name, value, visibility string, selectedRepos []string, token string, hostname ...string) error {
+	return AddOrgVariableCtx(context.Background(), org, name, value, visibility, selectedRepos, token, hostname...)
+}
+
+// Like AddOrgVariable, stopping when ctx is cancelled
+func AddOrgVariableCtx(ctx context.Context, org, name, value, visibility string, selectedRepos []string, token string, hostname ...string) error {
 	// Calls addGitHubVariable for an organization-level variable
-	return addGitHubVariable(EntityTypeOrg, org, "", name, value, visibility, token, hostname...)
+	return addGitHubVariable(ctx, EntityTypeOrg, org, "", "", name, value, visibility, selectedRepos, token, hostname...)
 }
 
 // Creates a repository-level variable in GitHub
 func AddRepoVariable(org, repo, name, value, visibility, token string, hostname ...string) error {
+	return AddRepoVariableCtx(context.Background(), org, repo, name, value, visibility, token, hostname...)
+}
+
+// Like AddRepoVariable, stopping when ctx is cancelled
+func AddRepoVariableCtx(ctx context.Context, org, repo, name, value, visibility, token string, hostname ...string) error {
 	// Calls addGitHubVariable for a repository-level variable
-	return addGitHubVariable(EntityTypeRepository, org, repo, name, value, visibility, token, hostname...)
+	return addGitHubVariable(ctx, EntityTypeRepository, org, repo, "", name, value, visibility, nil, token, hostname...)
+}
+
+// Creates an environment-level variable in GitHub
+func AddEnvVariable(org, repo, env, name, value, token string, hostname ...string) error {
+	return AddEnvVariableCtx(context.Background(), org, repo, env, name, value, token, hostname...)
+}
+
+// Like AddEnvVariable, stopping when ctx is cancelled
+func AddEnvVariableCtx(ctx context.Context, org, repo, env, name, value, token string, hostname ...string) error {
+	// Calls addGitHubVariable for an environment-level variable
+	return addGitHubVariable(ctx, EntityTypeEnvironment, org, repo, env, name, value, "", nil, token, hostname...)
 }
 
 // Checks if a repository exists in a given organization
-func doesRepositoryExist(org, repo, token string, hostname ...string) (bool, error) {
+func doesRepositoryExist(ctx context.Context, org, repo, token string, hostname ...string) (bool, error) {
 	// Initialize a new GitHub client
 	client, err := initializeGitHubClient(GitHubClientConfig{Token: token, Hostname: extractHostname(hostname...)})
 	if err != nil {
 		return false, fmt.Errorf("failed to initialize GitHub client: %w", err)
 	}
 
+	// Attempt to retrieve the repository, retrying transient failures
+	var resp *github.Response
+	err = retryWithContext(ctx, func() error {
+		ctx, cancel := createAPITimeoutContext(ctx)
+		defer cancel()
+		var apiErr error
+		_, resp, apiErr = client.Repositories.Get(ctx, org, repo)
+		// A 404 is a definitive answer, so return it without retrying
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		return apiErr
+	})
+	if err != nil {
+		return false, err
+	}
+	// Return true if the repository is found (status code 200)
+	return resp.StatusCode == http.StatusOK, nil
+}
+
+// Creates a deployment environment in a repository unless it already exists, reporting whether it was created.
+// Nothing is created when the repository itself doesn't exist, which adding the variable then reports.
+func EnsureEnvironment(org, repo, env, token string, hostname ...string) (bool, error) {
+	return EnsureEnvironmentCtx(context.Background(), org, repo, env, token, hostname...)
+}
+
+// Like EnsureEnvironment, stopping when ctx is cancelled
+func EnsureEnvironmentCtx(ctx context.Context, org, repo, env, token string, hostname ...string) (bool, error) {
+	exists, err := doesRepositoryExist(ctx, org, repo, token, hostname...)
+	if err != nil || !exists {
+		return false, err
+	}
+
+	client, err := initializeGitHubClient(GitHubClientConfig{Token: token, Hostname: extractHostname(hostname...)})
+	if err != nil {
+		return false, fmt.Errorf("failed to initialize GitHub client: %w", err)
+	}
+
+	// Look the environment up first, so existing environments and their protection rules are left untouched
+	var resp *github.Response
+	err = retryWithContext(ctx, func() error {
+		ctx, cancel := createAPITimeoutContext(ctx)
+		defer cancel()
+		var apiErr error
+		_, resp, apiErr = client.Repositories.GetEnvironment(ctx, org, repo, env)
+		// A 404 is a definitive answer, so return it without retrying
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		return apiErr
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to check environment %s: %w", env, err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		return false, nil
+	}
+
+	// Create the environment without protection rules
+	err = retryWithContext(ctx, func() error {
+		ctx, cancel := createAPITimeoutContext(ctx)
+		defer cancel()
+		_, _, apiErr := client.Repositories.CreateUpdateEnvironment(ctx, org, repo, env, nil)
+		return apiErr
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to create environment %s: %w", env, err)
+	}
+	return true, nil
+}
+
+// Reports whether GitHub Actions is enabled for a repository, which requires admin access to the repository
+func IsActionsEnabled(org, repo, token string, hostname ...string) (bool, error) {
+	return IsActionsEnabledCtx(context.Background(), org, repo, token, hostname...)
+}
+
+// Like IsActionsEnabled, stopping when ctx is cancelled
+func IsActionsEnabledCtx(ctx context.Context, org, repo, token string, hostname ...string) (bool, error) {
+	client, err := initializeGitHubClient(GitHubClientConfig{Token: token, Hostname: extractHostname(hostname...)})
+	if err != nil {
+		return false, fmt.Errorf("failed to initialize GitHub client: %w", err)
+	}
+
+	var permissions *github.ActionsPermissionsRepository
+	err = retryWithContext(ctx, func() error {
+		ctx, cancel := createAPITimeoutContext(ctx)
+		defer cancel()
+		var apiErr error
+		permissions, _, apiErr = client.Repositories.GetActionsPermissions(ctx, org, repo)
+		return apiErr
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch Actions permissions for %s: %w", repo, err)
+	}
+	return permissions.GetEnabled(), nil
+}
+
+// Counts the Actions secrets of an organization, or of a repository when repo is set, without reading any secret
+func CountSecrets(org, repo, token string, hostname ...string) (int, error) {
+	return CountSecretsCtx(context.Background(), org, repo, token, hostname...)
+}
+
+// Like CountSecrets, stopping when ctx is cancelled
+func CountSecretsCtx(ctx context.Context, org, repo, token string, hostname ...string) (int, error) {
+	client, err := initializeGitHubClient(GitHubClientConfig{Token: token, Hostname: extractHostname(hostname...)})
+	if err != nil {
+		return 0, fmt.Errorf("failed to initialize GitHub client: %w", err)
+	}
+
+	ctx, cancel := createAPITimeoutContext(ctx)
+	defer cancel()
+
+	// A single-item page is enough, as only the total count is needed
+	opts := &github.ListOptions{PerPage: 1}
+	var secrets *github.Secrets
+	if repo == "" {
+		secrets, _, err = client.Actions.ListOrgSecrets(ctx, org, opts)
+	} else {
+		secrets, _, err = client.Actions.ListRepoSecrets(ctx, org, repo, opts)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to count secrets%s: %w", requestIDSuffix(err), err)
+	}
+	return secrets.TotalCount, nil
+}
+
+// Counts the Dependabot secrets of an organization, or of a repository when repo is set, without reading any secret.
+// Dependabot has secrets but no variables, so these are never exported either.
+func CountDependabotSecrets(org, repo, token string, hostname ...string) (int, error) {
+	return CountDependabotSecretsCtx(context.Background(), org, repo, token, hostname...)
+}
+
+// Like CountDependabotSecrets, stopping when ctx is cancelled
+func CountDependabotSecretsCtx(ctx context.Context, org, repo, token string, hostname ...string) (int, error) {
+	client, err := initializeGitHubClient(GitHubClientConfig{Token: token, Hostname: extractHostname(hostname...)})
+	if err != nil {
+		return 0, fmt.Errorf("failed to initialize GitHub client: %w", err)
+	}
+
+	ctx, cancel := createAPITimeoutContext(ctx)
+	defer cancel()
+
+	opts := &github.ListOptions{PerPage: 1}
+	var secrets *github.Secrets
+	if repo == "" {
+		secrets, _, err = client.Dependabot.ListOrgSecrets(ctx, org, opts)
+	} else {
+		secrets, _, err = client.Dependabot.ListRepoSecrets(ctx, org, repo, opts)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to count Dependabot secrets%s: %w", requestIDSuffix(err), err)
+	}
+	return secrets.TotalCount, nil
+}
+
+// Verifies that an organization exists and is accessible with the given token
+func ValidateOrganization(org, token string, hostname ...string) error {
+	return ValidateOrganizationCtx(context.Background(), org, token, hostname...)
+}
+
+// Like ValidateOrganization, stopping when ctx is cancelled
+func ValidateOrganizationCtx(ctx context.Context, org, token string, hostname ...string) error {
+	// Initialize a new GitHub client
+	client, err := initializeGitHubClient(GitHubClientConfig{Token: token, Hostname: extractHostname(hostname...)})
+	if err != nil {
+		return fmt.Errorf("failed to initialize GitHub client: %w", err)
+	}
+
 	// Create a context with a timeout
-	ctx, cancel := createAPITimeoutContext()
+	ctx, cancel := createAPITimeoutContext(ctx)
 	defer cancel()
 
-	// Attempt to retrieve the repository
-	_, resp, err := client.Repositories.Get(ctx, org, repo)
+	// Attempt to retrieve the organization
+	_, resp, err := client.Organizations.Get(ctx, org)
 	if err != nil {
-		return false, nil
+		// A 404 means the organization doesn't exist or the token can't see it, while 401/403 are auth failures
+		if resp != nil {
+			switch resp.StatusCode {
+			case http.StatusNotFound, http.StatusUnauthorized, http.StatusForbidden:
+				return fmt.Errorf("organization %s %w", org, ErrOrganizationNotAccessible)
+			}
+		}
+		return fmt.Errorf("failed to fetch organization %s%s: %w", org, requestIDSuffix(err), err)
 	}
-	// Return true if the repository is found (status code 200)
-	return resp.StatusCode == 200, nil
+
+	return nil
+}
+
+// Reports whether an owner is an organization or a user account
+func FetchOwnerType(owner, token string, hostname ...string) (string, error) {
+	return FetchOwnerTypeCtx(context.Background(), owner, token, hostname...)
+}
+
+// Like FetchOwnerType, stopping when ctx is cancelled
+func FetchOwnerTypeCtx(ctx context.Context, owner, token string, hostname ...string) (string, error) {
+	client, err := initializeGitHubClient(GitHubClientConfig{Token: token, Hostname: extractHostname(hostname...)})
+	if err != nil {
+		return "", fmt.Errorf("failed to initialize GitHub client: %w", err)
+	}
+
+	ctx, cancel := createAPITimeoutContext(ctx)
+	defer cancel()
+
+	account, resp, err := client.Users.Get(ctx, owner)
+	if err != nil {
+		// Owners are given as organizations, so a mistyped name is reported the way ValidateOrganization reports it
+		if resp != nil {
+			switch resp.StatusCode {
+			case http.StatusNotFound, http.StatusUnauthorized, http.StatusForbidden:
+				return "", fmt.Errorf("organization %s %w", owner, ErrOrganizationNotAccessible)
+			}
+		}
+		return "", fmt.Errorf("failed to fetch owner %s%s: %w", owner, requestIDSuffix(err), err)
+	}
+	return account.GetType(), nil
 }
 
-// Lists paginated GitHub resources, such as repositories
-func listPaginatedRepositories(fetch func(opts *github.RepositoryListByOrgOptions) ([]*github.Repository, *github.Response, error)) ([]string, error) {
-	// Set up pagination options, requesting 100 items per page
+// Lists paginated GitHub resources, such as repositories, retrying each page. If a page still fails,
+// the repositories listed so far are returned with an error wrapping ErrRepositoryListIncomplete.
+func listPaginatedRepositories(ctx context.Context, listConfig RepositoryListConfig, fetch func(opts *github.RepositoryListByOrgOptions) ([]*github.Repository, *github.Response, error)) ([]Repository, error) {
+	// Set up pagination options, requesting a full page of items in the requested order
 	opts := &github.RepositoryListByOrgOptions{
-		ListOptions: github.ListOptions{PerPage: 100},
+		Sort:        listConfig.Sort,
+		ListOptions: github.ListOptions{PerPage: pageSize},
 	}
-	var allResources []string
+	var allResources []Repository
 
 	// Iterate through pages of results
-	for {
-		repos, resp, err := fetch(opts)
-		if err != nil {
-			return nil, err
+	for page := 1; ; page++ {
+		var repos []*github.Repository
+		var resp *github.Response
+		err := retryWithContext(ctx, func() error {
+			var apiErr error
+			repos, resp, apiErr = fetch(opts)
+			return apiErr
+		})
+		if err == nil && repos == nil {
+			err = fmt.Errorf("no data returned")
 		}
-		if repos == nil {
-			return nil, fmt.Errorf("no data returned")
+		if err != nil {
+			if page == 1 {
+				return nil, err
+			}
+			return allResources, fmt.Errorf("%w: page %d failed after %d repositories were listed: %w", ErrRepositoryListIncomplete, page, len(allResources), err)
 		}
 
-		// Collect repository names from the current page
+		// Collect repositories from the current page
 		for _, repo := range repos {
 			if repo != nil && repo.Name != nil {
-				allResources = append(allResources, *repo.Name)
+				allResources = append(allResources, Repository{
+					Name:          repo.GetName(),
+					DefaultBranch: repo.GetDefaultBranch(),
+					Visibility:    repo.GetVisibility(),
+					Topics:        repo.Topics,
+				})
 			}
 		}
 
@@ -408,17 +1516,67 @@ func listPaginatedRepositories(fetch func(opts *github.RepositoryListByOrgOption
 }
 
 // Retrieves a list of repositories for a given organization
-func FetchAllRepositories(org, token string, hostname ...string) ([]string, error) {
+func FetchAllRepositories(org, token string, listConfig RepositoryListConfig, hostname ...string) ([]Repository, error) {
+	return FetchAllRepositoriesCtx(context.Background(), org, token, listConfig, hostname...)
+}
+
+// Like FetchAllRepositories, stopping when ctx is cancelled
+func FetchAllRepositoriesCtx(ctx context.Context, org, token string, listConfig RepositoryListConfig, hostname ...string) ([]Repository, error) {
 	// Initialize a new GitHub client
 	client, err := initializeGitHubClient(GitHubClientConfig{Token: token, Hostname: extractHostname(hostname...)})
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize GitHub client: %w", err)
 	}
 
+	if listConfig.UserAccount {
+		return fetchUserRepositories(ctx, client, org, listConfig)
+	}
+
+	// Team repositories come back in the team's own order, as the team listing can't be sorted
+	if listConfig.Team != "" {
+		return listPaginatedRepositories(ctx, listConfig, func(opts *github.RepositoryListByOrgOptions) ([]*github.Repository, *github.Response, error) {
+			ctx, cancel := createAPITimeoutContext(ctx)
+			defer cancel()
+			return client.Teams.ListTeamReposBySlug(ctx, org, listConfig.Team, &opts.ListOptions)
+		})
+	}
+
 	// Use listPaginatedRepositories to fetch all repositories in the organization
-	return listPaginatedRepositories(func(opts *github.RepositoryListByOrgOptions) ([]*github.Repository, *github.Response, error) {
-		ctx, cancel := createAPITimeoutContext()
+	return listPaginatedRepositories(ctx, listConfig, func(opts *github.RepositoryListByOrgOptions) ([]*github.Repository, *github.Response, error) {
+		ctx, cancel := createAPITimeoutContext(ctx)
 		defer cancel()
 		return client.Repositories.ListByOrg(ctx, org, opts)
 	})
 }
+
+// Retrieves the repositories owned by a user account. Private repositories are only
+// included when the token belongs to that user, as GitHub lists them for no one else.
+func fetchUserRepositories(ctx context.Context, client *github.Client, user string, listConfig RepositoryListConfig) ([]Repository, error) {
+	userCtx, cancel := createAPITimeoutContext(ctx)
+	authenticated, _, err := client.Users.Get(userCtx, "")
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch authenticated user%s: %w", requestIDSuffix(err), err)
+	}
+
+	if strings.EqualFold(authenticated.GetLogin(), user) {
+		return listPaginatedRepositories(ctx, listConfig, func(opts *github.RepositoryListByOrgOptions) ([]*github.Repository, *github.Response, error) {
+			ctx, cancel := createAPITimeoutContext(ctx)
+			defer cancel()
+			return client.Repositories.ListByAuthenticatedUser(ctx, &github.RepositoryListByAuthenticatedUserOptions{
+				Affiliation: "owner",
+				Sort:        opts.Sort,
+				ListOptions: opts.ListOptions,
+			})
+		})
+	}
+
+	return listPaginatedRepositories(ctx, listConfig, func(opts *github.RepositoryListByOrgOptions) ([]*github.Repository, *github.Response, error) {
+		ctx, cancel := createAPITimeoutContext(ctx)
+		defer cancel()
+		return client.Repositories.ListByUser(ctx, user, &github.RepositoryListByUserOptions{
+			Sort:        opts.Sort,
+			ListOptions: opts.ListOptions,
+		})
+	})
+}
@@ -0,0 +1,322 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-github/v66/github"
+)
+
+// Returns a client sending every request to the test server
+func newTestClient(t *testing.T, server *httptest.Server) *github.Client {
+	t.Helper()
+	baseURL, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := github.NewClient(server.Client())
+	client.BaseURL = baseURL
+	return client
+}
+
+func TestFetchSelectedRepositoryNamesFollowsPages(t *testing.T) {
+	pages := map[string]string{
+		"":  `{"total_count": 3, "repositories": [{"name": "api"}, {"name": "web"}]}`,
+		"2": `{"total_count": 3, "repositories": [{"name": "worker"}]}`,
+	}
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/orgs/mona-actions/actions/variables/API_URL/repositories" {
+			http.NotFound(w, r)
+			return
+		}
+		page := r.URL.Query().Get("page")
+		if page == "" {
+			w.Header().Set("Link", fmt.Sprintf(`<%s%s?page=2>; rel="next", <%s%s?page=2>; rel="last"`, server.URL, r.URL.Path, server.URL, r.URL.Path))
+		}
+		body, ok := pages[page]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+
+	names, err := fetchSelectedRepositoryNames(context.Background(), newTestClient(t, server), "mona-actions", "API_URL")
+	if err != nil {
+		t.Fatalf("fetchSelectedRepositoryNames() error = %v", err)
+	}
+	if want := []string{"api", "web", "worker"}; !slices.Equal(names, want) {
+		t.Errorf("fetchSelectedRepositoryNames() = %v, want %v", names, want)
+	}
+}
+
+func TestBypassesProxy(t *testing.T) {
+	tests := []struct {
+		url     string
+		noProxy string
+		want    bool
+	}{
+		{"https://github.example.com/api/v3", "", false},
+		{"https://github.example.com/api/v3", "*", true},
+		{"https://github.example.com/api/v3", "github.example.com", true},
+		{"https://GitHub.Example.com./api/v3", "github.example.com", true},
+		{"https://github.example.com/api/v3", "other.example.com, github.example.com", true},
+		{"https://api.github.example.com/", "github.example.com", true},
+		{"https://notgithub.example.com/", "github.example.com", false},
+
+		// Wildcards and leading dots match only subdomains
+		{"https://github.internal.example.com/", "*.internal.example.com", true},
+		{"https://a.b.internal.example.com/", "*.internal.example.com", true},
+		{"https://internal.example.com/", "*.internal.example.com", false},
+		{"https://github.internal.example.com/", ".internal.example.com", true},
+		{"https://internal.example.com/", ".internal.example.com", false},
+		{"https://github.example.org/", "*.internal.example.com", false},
+
+		// CIDR ranges and addresses match IP hosts only
+		{"https://10.1.2.3/api/v3", "10.0.0.0/8", true},
+		{"https://11.1.2.3/api/v3", "10.0.0.0/8", false},
+		{"https://192.168.1.20:8443/", "192.168.1.0/24", true},
+		{"https://[fd00::1]/api/v3", "fd00::/8", true},
+		{"https://[2001:db8::1]/api/v3", "fd00::/8", false},
+		{"https://10.1.2.3/", "10.1.2.3", true},
+		{"https://github.example.com/", "10.0.0.0/8", false},
+
+		// Ports only need to match when the entry names one
+		{"https://github.example.com:8443/", "github.example.com", true},
+		{"https://github.example.com/", "github.example.com:443", true},
+		{"https://github.example.com:8443/", "github.example.com:443", false},
+		{"http://github.example.com/", "github.example.com:80", true},
+		{"https://github.internal.example.com:8443/", "*.internal.example.com:8443", true},
+	}
+	for _, tt := range tests {
+		requestURL, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := bypassesProxy(requestURL, tt.noProxy); got != tt.want {
+			t.Errorf("bypassesProxy(%s, %q) = %v, want %v", tt.url, tt.noProxy, got, tt.want)
+		}
+	}
+}
+
+func TestProxyAuthorization(t *testing.T) {
+	// Stands in for an authenticated proxy, answering only requests carrying the expected credentials
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := parseProxyAuthorization(r.Header.Get("Proxy-Authorization"))
+		if !ok || user != "proxyuser" || password != "p@ss:word" {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		if r.URL.Host != "github.example.com" {
+			t.Errorf("proxy got a request for %s, want github.example.com", r.URL.Host)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxy.Close()
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inline := *proxyURL
+	inline.User = url.UserPassword("proxyuser", "p@ss:word")
+	wrongInline := *proxyURL
+	wrongInline.User = url.UserPassword("other", "secret")
+
+	tests := []struct {
+		name   string
+		config ProxyConfig
+		want   int
+	}{
+		{"inline credentials", ProxyConfig{HTTPProxy: inline.String()}, http.StatusOK},
+		{"flag credentials", ProxyConfig{HTTPProxy: proxy.URL, ProxyUser: "proxyuser", ProxyPassword: "p@ss:word"}, http.StatusOK},
+		{"inline credentials take precedence", ProxyConfig{HTTPProxy: wrongInline.String(), ProxyUser: "proxyuser", ProxyPassword: "p@ss:word"}, http.StatusProxyAuthRequired},
+		{"no credentials", ProxyConfig{HTTPProxy: proxy.URL}, http.StatusProxyAuthRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &http.Client{Transport: &http.Transport{Proxy: buildProxyFunction(&tt.config)}}
+			resp, err := client.Get("http://github.example.com/api/v3")
+			if err != nil {
+				t.Fatalf("request through proxy failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+// Decodes a basic Proxy-Authorization header
+func parseProxyAuthorization(header string) (string, string, bool) {
+	req := &http.Request{Header: http.Header{"Authorization": {header}}}
+	return req.BasicAuth()
+}
+
+func TestProxyAuthorizationOnConnect(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer target.Close()
+
+	// Opens a tunnel to the target only for requests carrying the expected credentials
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := parseProxyAuthorization(r.Header.Get("Proxy-Authorization"))
+		if r.Method != http.MethodConnect || !ok || user != "proxyuser" || password != "secret" {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		go func() {
+			io.Copy(upstream, conn)
+			upstream.Close()
+		}()
+		io.Copy(conn, upstream)
+		conn.Close()
+	}))
+	defer proxy.Close()
+
+	tlsConfig := target.Client().Transport.(*http.Transport).TLSClientConfig
+	for _, config := range []ProxyConfig{
+		{HTTPSProxy: strings.Replace(proxy.URL, "http://", "http://proxyuser:secret@", 1)},
+		{HTTPSProxy: proxy.URL, ProxyUser: "proxyuser", ProxyPassword: "secret"},
+	} {
+		client := &http.Client{Transport: &http.Transport{Proxy: buildProxyFunction(&config), TLSClientConfig: tlsConfig}}
+		resp, err := client.Get(target.URL)
+		if err != nil {
+			t.Fatalf("request through proxy %+v failed: %v", config, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("request through proxy %+v: status = %d, want %d", config, resp.StatusCode, http.StatusOK)
+		}
+	}
+
+	client := &http.Client{Transport: &http.Transport{Proxy: buildProxyFunction(&ProxyConfig{HTTPSProxy: proxy.URL}), TLSClientConfig: tlsConfig}}
+	if resp, err := client.Get(target.URL); err == nil {
+		resp.Body.Close()
+		t.Errorf("request through proxy without credentials succeeded, want the tunnel refused")
+	}
+}
+
+func TestOrgVariableVisibilityRoundTrip(t *testing.T) {
+	// Serves a source organization's variables and records the variables created in the target organization
+	var mu sync.Mutex
+	created := make(map[string]github.ActionsVariable)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v3/orgs/source/actions/variables":
+			fmt.Fprint(w, `{"total_count": 3, "variables": [
+				{"name": "ALL_VAR", "value": "a", "visibility": "all"},
+				{"name": "PRIVATE_VAR", "value": "p", "visibility": "private"},
+				{"name": "SELECTED_VAR", "value": "s", "visibility": "selected"}]}`)
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v3/orgs/source/actions/variables/SELECTED_VAR/repositories":
+			fmt.Fprint(w, `{"total_count": 2, "repositories": [{"name": "api"}, {"name": "web"}]}`)
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v3/repos/target/api":
+			fmt.Fprint(w, `{"id": 101, "name": "api"}`)
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v3/repos/target/web":
+			fmt.Fprint(w, `{"id": 102, "name": "web"}`)
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v3/orgs/target/actions/variables":
+			var variable github.ActionsVariable
+			if err := json.NewDecoder(r.Body).Decode(&variable); err != nil {
+				t.Errorf("invalid variable sent: %v", err)
+			}
+			mu.Lock()
+			created[variable.Name] = variable
+			mu.Unlock()
+			w.WriteHeader(http.StatusCreated)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	exported, err := FetchOrgVariablesCtx(ctx, "source", "token", server.URL)
+	if err != nil {
+		t.Fatalf("FetchOrgVariablesCtx() error = %v", err)
+	}
+	for _, variable := range exported {
+		var selected []string
+		if variable["SelectedRepositories"] != "" {
+			selected = strings.Split(variable["SelectedRepositories"], SelectedRepositoriesSeparator)
+		}
+		if err := AddOrgVariableCtx(ctx, "target", variable["Name"], variable["Value"], variable["Visibility"], selected, "token", server.URL); err != nil {
+			t.Fatalf("AddOrgVariableCtx(%s) error = %v", variable["Name"], err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		visibility  string
+		selected    string
+		selectedIDs []int64
+	}{
+		{"ALL_VAR", "all", "", nil},
+		{"PRIVATE_VAR", "private", "", nil},
+		{"SELECTED_VAR", VisibilitySelected, "api;web", []int64{101, 102}},
+	}
+	if len(exported) != len(tests) {
+		t.Fatalf("exported %d variables, want %d", len(exported), len(tests))
+	}
+	for i, tt := range tests {
+		if exported[i]["Name"] != tt.name || exported[i]["Visibility"] != tt.visibility || exported[i]["SelectedRepositories"] != tt.selected {
+			t.Errorf("exported %v, want %s with visibility %q and selected repositories %q", exported[i], tt.name, tt.visibility, tt.selected)
+		}
+		variable, ok := created[tt.name]
+		if !ok {
+			t.Errorf("%s was not created in the target", tt.name)
+			continue
+		}
+		if variable.GetVisibility() != tt.visibility {
+			t.Errorf("%s created with visibility %q, want %q", tt.name, variable.GetVisibility(), tt.visibility)
+		}
+		var ids []int64
+		if variable.SelectedRepositoryIDs != nil {
+			ids = *variable.SelectedRepositoryIDs
+		}
+		if !slices.Equal(ids, tt.selectedIDs) {
+			t.Errorf("%s created with selected repository IDs %v, want %v", tt.name, ids, tt.selectedIDs)
+		}
+	}
+}
+
+func TestParseGitHubVariableMissingVisibility(t *testing.T) {
+	variable := &github.ActionsVariable{Name: "API_URL", Value: "https://api.example.com"}
+	// Defaulting an organization variable would change which repositories can use it
+	if got := parseGitHubVariable(variable, EntityTypeOrg)["Visibility"]; got != "" {
+		t.Errorf("organization variable visibility = %q, want it left empty", got)
+	}
+	if got := parseGitHubVariable(variable, "webapp")["Visibility"]; got != defaultVariableVisibility {
+		t.Errorf("repository variable visibility = %q, want %q", got, defaultVariableVisibility)
+	}
+	err := AddOrgVariable("target", "API_URL", "https://api.example.com", "", nil, "token", "http://127.0.0.1:1")
+	if err == nil || !strings.Contains(err.Error(), "has no visibility") {
+		t.Errorf("AddOrgVariable() without a visibility error = %v, want it rejected for having no visibility", err)
+	}
+}
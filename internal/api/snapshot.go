@@ -0,0 +1,105 @@
+package api
+
+import (
+	"strings"
+	"sync"
+)
+
+// VariableSnapshot caches a target's existing variables so each scope is listed at most once.
+// Organization variables are fetched on first use, and repository and environment variables
+// are fetched lazily the first time each repository or environment is looked up.
+type VariableSnapshot struct {
+	org      string
+	token    string
+	hostname string
+
+	mu     sync.Mutex
+	scopes map[string]map[string]map[string]string
+}
+
+// Creates an empty snapshot for the given organization
+func NewVariableSnapshot(org, token string, hostname ...string) *VariableSnapshot {
+	return &VariableSnapshot{
+		org:      org,
+		token:    token,
+		hostname: extractHostname(hostname...),
+		scopes:   make(map[string]map[string]map[string]string),
+	}
+}
+
+// Looks up an organization variable by name
+func (s *VariableSnapshot) OrgVariable(name string) (map[string]string, bool, error) {
+	return s.lookup(EntityTypeOrg, name, func() ([]map[string]string, error) {
+		return FetchOrgVariables(s.org, s.token, s.hostname)
+	})
+}
+
+// Looks up a repository variable by name in a repository owned by the given owner
+func (s *VariableSnapshot) RepoVariable(owner, repo, name string) (map[string]string, bool, error) {
+	return s.lookup(owner+"/"+repo, name, func() ([]map[string]string, error) {
+		return FetchRepoVariables(owner, repo, s.token, s.hostname)
+	})
+}
+
+// Looks up an environment variable by name in a repository environment
+func (s *VariableSnapshot) EnvVariable(owner, repo, env, name string) (map[string]string, bool, error) {
+	return s.lookup(owner+"/"+repo+"/"+env, name, func() ([]map[string]string, error) {
+		return FetchEnvVariables(owner, repo, env, s.token, s.hostname)
+	})
+}
+
+// Returns the number of organization variables
+func (s *VariableSnapshot) OrgVariableCount() (int, error) {
+	variables, err := s.load(EntityTypeOrg, func() ([]map[string]string, error) {
+		return FetchOrgVariables(s.org, s.token, s.hostname)
+	})
+	return len(variables), err
+}
+
+// Returns the number of variables in a repository owned by the given owner
+func (s *VariableSnapshot) RepoVariableCount(owner, repo string) (int, error) {
+	variables, err := s.load(owner+"/"+repo, func() ([]map[string]string, error) {
+		return FetchRepoVariables(owner, repo, s.token, s.hostname)
+	})
+	return len(variables), err
+}
+
+// Returns the number of variables in a repository environment
+func (s *VariableSnapshot) EnvVariableCount(owner, repo, env string) (int, error) {
+	variables, err := s.load(owner+"/"+repo+"/"+env, func() ([]map[string]string, error) {
+		return FetchEnvVariables(owner, repo, env, s.token, s.hostname)
+	})
+	return len(variables), err
+}
+
+// Returns a variable from a scope, loading the scope's variables on first use.
+// Names are compared case-insensitively, as GitHub does.
+func (s *VariableSnapshot) lookup(scope, name string, load func() ([]map[string]string, error)) (map[string]string, bool, error) {
+	variables, err := s.load(scope, load)
+	if err != nil {
+		return nil, false, err
+	}
+	variable, found := variables[strings.ToUpper(name)]
+	return variable, found, nil
+}
+
+// Returns a scope's variables keyed by upper-cased name, listing them on first use
+func (s *VariableSnapshot) load(scope string, load func() ([]map[string]string, error)) (map[string]map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if variables, ok := s.scopes[scope]; ok {
+		return variables, nil
+	}
+
+	fetched, err := load()
+	if err != nil {
+		return nil, err
+	}
+	variables := make(map[string]map[string]string, len(fetched))
+	for _, variable := range fetched {
+		variables[strings.ToUpper(variable["Name"])] = variable
+	}
+	s.scopes[scope] = variables
+	return variables, nil
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/pterm/pterm"
+	"golang.org/x/oauth2"
+)
+
+// Returned when GitHub rejects the token, as short-lived tokens do once they expire partway through a run,
+// and no new token could be obtained. Every remaining call would be rejected too.
+var ErrTokenExpired = errors.New("GitHub token expired or was revoked")
+
+// Returned when GitHub rejects a token it never accepted during the run, such as a mistyped or deleted token
+var ErrTokenUnauthorized = errors.New("GitHub token is invalid or not authorized")
+
+// Tokens known to have worked during the run: accepted by GitHub at least once, or rejected and then refreshed.
+// Only a rejection of one of these means the token expired; any other token was never valid.
+var (
+	validTokensMu sync.Mutex
+	validTokens   = make(map[string]bool)
+)
+
+// Records that a token worked during the run
+func markTokenValid(token string) {
+	validTokensMu.Lock()
+	defer validTokensMu.Unlock()
+	validTokens[token] = true
+}
+
+// Returns the error for a call GitHub rejected with a 401: ErrTokenExpired when the token it was sent with had
+// worked before, and ErrTokenUnauthorized otherwise
+func tokenRejectedError(err error) error {
+	response := errorResponse(err)
+	if response == nil || response.Request == nil {
+		return ErrTokenUnauthorized
+	}
+	validTokensMu.Lock()
+	defer validTokensMu.Unlock()
+	if validTokens[bearerToken(response.Request)] {
+		return ErrTokenExpired
+	}
+	return ErrTokenUnauthorized
+}
+
+// Returns the token a request is authorized with
+func bearerToken(req *http.Request) string {
+	token, _ := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return token
+}
+
+// Records the token of every request GitHub accepts. It sits below the OAuth transport, which adds the token.
+type tokenValidationTransport struct {
+	base http.RoundTripper
+}
+
+func (t *tokenValidationTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err == nil && resp.StatusCode != http.StatusUnauthorized {
+		if token := bearerToken(req); token != "" {
+			markTokenValid(token)
+		}
+	}
+	return resp, err
+}
+
+// Token a run started with, which is replaced by running its refresh command when GitHub rejects it
+type refreshableToken struct {
+	mu      sync.Mutex
+	current string
+	command []string
+}
+
+// Tokens that can be refreshed, keyed by the token the run started with, as every call is passed that token
+var (
+	refreshableTokensMu sync.Mutex
+	refreshableTokens   = make(map[string]*refreshableToken)
+)
+
+// Sets the command run to obtain a new token when GitHub rejects the given one, such as gh auth token
+// or a script that generates a GitHub App installation token. The command is split on whitespace and run
+// without a shell, and the token is read from its output.
+func SetTokenCommand(token, command string) {
+	refreshableTokensMu.Lock()
+	defer refreshableTokensMu.Unlock()
+	refreshableTokens[token] = &refreshableToken{current: token, command: strings.Fields(command)}
+}
+
+// Returns the refreshable token started with the given token, or nil when it has no refresh command
+func lookupRefreshableToken(token string) *refreshableToken {
+	refreshableTokensMu.Lock()
+	defer refreshableTokensMu.Unlock()
+	return refreshableTokens[token]
+}
+
+// Returns the token currently in use
+func (t *refreshableToken) Token() (*oauth2.Token, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return &oauth2.Token{AccessToken: t.current}, nil
+}
+
+// Replaces a rejected token by running the refresh command. Concurrent calls rejected with the same token
+// share one refresh: those arriving after it get the new token without running the command again.
+func (t *refreshableToken) refresh(rejected string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.current != rejected {
+		return t.current, nil
+	}
+	// Even when the command fails, the rejected token was refreshable, so its rejection is reported as an expiry
+	markTokenValid(rejected)
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(t.command[0], t.command[1:]...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("token command %s failed: %w: %s", t.command[0], err, strings.TrimSpace(stderr.String()))
+	}
+	token := strings.TrimSpace(stdout.String())
+	if token == "" {
+		return "", fmt.Errorf("token command %s printed no token", t.command[0])
+	}
+	t.current = token
+	return token, nil
+}
+
+// Refreshes the token when GitHub rejects it with a 401, then sends the request again with the new token
+type tokenRefreshTransport struct {
+	base  http.RoundTripper
+	token *refreshableToken
+}
+
+func (t *tokenRefreshTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	sent, _ := t.token.Token()
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	// A request whose body was already consumed can't be sent again
+	if req.Body != nil && req.GetBody == nil {
+		return resp, err
+	}
+
+	fresh, refreshErr := t.token.refresh(sent.AccessToken)
+	if refreshErr != nil {
+		pterm.Warning.Printf("GitHub rejected the token and it couldn't be refreshed: %v\n", refreshErr)
+		return resp, err
+	}
+	if fresh == sent.AccessToken {
+		return resp, err
+	}
+	resp.Body.Close()
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return t.base.RoundTrip(retry)
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRejectedTokenError(t *testing.T) {
+	// Accepts the first call with the rotating token only, and no call with the mistyped token
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get("Authorization") != "Bearer rotating-token" || calls > 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"message": "Bad credentials"}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"total_count": 0, "variables": []}`)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	if _, err := FetchOrgVariablesCtx(ctx, "mona-actions", "mistyped-token", server.URL); !errors.Is(err, ErrTokenUnauthorized) {
+		t.Errorf("token never accepted: error = %v, want %v", err, ErrTokenUnauthorized)
+	}
+
+	calls = 0
+	if _, err := FetchOrgVariablesCtx(ctx, "mona-actions", "rotating-token", server.URL); err != nil {
+		t.Fatalf("first call with the token: error = %v", err)
+	}
+	if _, err := FetchOrgVariablesCtx(ctx, "mona-actions", "rotating-token", server.URL); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("token accepted earlier: error = %v, want %v", err, ErrTokenExpired)
+	}
+
+	// A rejection after a refresh was attempted is reported as an expiry, even when the refresh fails
+	SetTokenCommand("refreshable-token", "false")
+	if _, err := FetchOrgVariablesCtx(ctx, "mona-actions", "refreshable-token", server.URL); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("token refresh attempted: error = %v, want %v", err, ErrTokenExpired)
+	}
+}
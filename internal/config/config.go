@@ -0,0 +1,110 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// RuntimeConfig holds the tuning options shared across commands, resolved once from flags,
+// environment variables, and profiles so every option is validated in the same place
+type RuntimeConfig struct {
+	// Maximum attempts for each API call
+	RetryMax int
+
+	// Delay before the first retry, doubled after each further attempt
+	RetryDelay time.Duration
+
+	// Maximum attempts and first retry delay for transient network errors, RetryMax and RetryDelay unless set
+	NetworkRetryMax   int
+	NetworkRetryDelay time.Duration
+
+	// Maximum attempts for rate-limit errors, RetryMax unless set
+	RateLimitRetryMax int
+
+	// Longest wait for a rate limit to reset before retrying, or zero to back off from RetryDelay
+	RateLimitMaxWait time.Duration
+
+	// HTTP status codes that are retried, or empty to retry every failed call
+	RetryStatusCodes []int
+
+	// Maximum number of organizations exported concurrently
+	OrgConcurrency int
+
+	// Maximum number of repositories scanned concurrently within an organization
+	RepoConcurrency int
+
+	// Maximum number of environments scanned concurrently within a repository
+	EnvironmentConcurrency int
+
+	// Longest time exported variables are buffered before being flushed to the output file
+	FlushInterval time.Duration
+
+	// Pause before starting each batch of RepoBatchSize repositories, easing the load on throttled servers
+	RepoBatchDelay time.Duration
+	RepoBatchSize  int
+
+	// Number of items requested per page when listing repositories, variables, and environments
+	PageSize int
+
+	// Maximum idle connections kept open for reuse, and how long each may stay idle, or zero for no limit
+	MaxIdleConns    int
+	IdleConnTimeout time.Duration
+
+	// Number of failed variables after which a sync is aborted, or zero to never abort
+	MaxFailures int
+}
+
+// Checks that every option is within its allowed range
+func (c RuntimeConfig) Validate() error {
+	if c.RetryMax < 1 {
+		return fmt.Errorf("invalid retry max %d: must be at least 1", c.RetryMax)
+	}
+	if c.RetryDelay < 0 {
+		return fmt.Errorf("invalid retry delay %v: must not be negative", c.RetryDelay)
+	}
+	if c.NetworkRetryMax < 1 {
+		return fmt.Errorf("invalid network retry max %d: must be at least 1", c.NetworkRetryMax)
+	}
+	if c.NetworkRetryDelay < 0 {
+		return fmt.Errorf("invalid network retry delay %v: must not be negative", c.NetworkRetryDelay)
+	}
+	if c.RateLimitRetryMax < 1 {
+		return fmt.Errorf("invalid rate limit retry max %d: must be at least 1", c.RateLimitRetryMax)
+	}
+	if c.RateLimitMaxWait < 0 {
+		return fmt.Errorf("invalid rate limit max wait %v: must not be negative", c.RateLimitMaxWait)
+	}
+	for _, code := range c.RetryStatusCodes {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("invalid retry status code %d: must be between 100 and 599", code)
+		}
+	}
+	if c.OrgConcurrency < 1 {
+		return fmt.Errorf("invalid org concurrency %d: must be at least 1", c.OrgConcurrency)
+	}
+	if c.RepoConcurrency < 1 {
+		return fmt.Errorf("invalid repo concurrency %d: must be at least 1", c.RepoConcurrency)
+	}
+	if c.EnvironmentConcurrency < 1 {
+		return fmt.Errorf("invalid environment concurrency %d: must be at least 1", c.EnvironmentConcurrency)
+	}
+	if c.FlushInterval < 0 {
+		return fmt.Errorf("invalid flush interval %v: must not be negative", c.FlushInterval)
+	}
+	if c.RepoBatchDelay < 0 {
+		return fmt.Errorf("invalid repo batch delay %v: must not be negative", c.RepoBatchDelay)
+	}
+	if c.RepoBatchSize < 1 {
+		return fmt.Errorf("invalid repo batch size %d: must be at least 1", c.RepoBatchSize)
+	}
+	if c.MaxIdleConns < 1 {
+		return fmt.Errorf("invalid max idle connections %d: must be at least 1", c.MaxIdleConns)
+	}
+	if c.IdleConnTimeout < 0 {
+		return fmt.Errorf("invalid idle connection timeout %v: must not be negative", c.IdleConnTimeout)
+	}
+	if c.MaxFailures < 0 {
+		return fmt.Errorf("invalid max failures %d: must not be negative", c.MaxFailures)
+	}
+	return nil
+}
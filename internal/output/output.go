@@ -0,0 +1,57 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/pterm/pterm"
+)
+
+// Guards the terminal, so writes from concurrent goroutines are never interleaved
+var mu sync.Mutex
+
+// Writes to the current standard output one write at a time. Standard output is looked up on every write,
+// so redirections such as --stdout and --summary-json apply to everything printed.
+type terminal struct{}
+
+func (terminal) Write(p []byte) (int, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	return os.Stdout.Write(p)
+}
+
+// Writer is the single destination of everything export and sync print, including the spinner
+var Writer io.Writer = terminal{}
+
+// pterm's printers are pointed at Writer so their lines go through it too. Because the spinner writes to the same
+// Writer, pterm clears the spinner's line before each printed line rather than printing over it.
+func init() {
+	pterm.SetDefaultOutput(Writer)
+	for _, printer := range []*pterm.PrefixPrinter{&pterm.Info, &pterm.Success, &pterm.Warning, &pterm.Error, &pterm.Debug} {
+		printer.Writer = Writer
+	}
+}
+
+// Prints like fmt.Printf, as a single write to Writer
+func Printf(format string, args ...any) {
+	pterm.Fprint(Writer, fmt.Sprintf(format, args...))
+}
+
+// Prints like fmt.Println, as a single write to Writer
+func Println(args ...any) {
+	pterm.Fprint(Writer, fmt.Sprintln(args...))
+}
+
+// Starts a spinner writing to Writer
+func StartSpinner(text string) *pterm.SpinnerPrinter {
+	spinner, _ := pterm.DefaultSpinner.WithWriter(Writer).Start(text)
+	return spinner
+}
+
+// Reports whether standard output is attached to a terminal
+func IsTerminal() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,58 @@
+package summary
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/mona-actions/gh-migrate-variables/internal/output"
+)
+
+// Standard output, set aside for the JSON summary when one is requested
+var jsonOutput *os.File
+
+// Reserves standard output for a JSON summary and sends all other output to standard error, so the summary can be piped
+func UseJSON() {
+	jsonOutput = os.Stdout
+	os.Stdout = os.Stderr
+}
+
+// Reports whether the summary is printed as JSON instead of the human-readable template
+func JSON() bool {
+	return jsonOutput != nil
+}
+
+// Prints a run's result as a single line of JSON on the standard output reserved by UseJSON
+func PrintJSON(data any) error {
+	if err := json.NewEncoder(jsonOutput).Encode(data); err != nil {
+		return fmt.Errorf("failed to print summary: %w", err)
+	}
+	return nil
+}
+
+// Prints a run summary by executing a text/template against the run's result.
+// The template is read from templateFile when one is given, otherwise defaultTemplate is used.
+func Print(templateFile, defaultTemplate string, data any) error {
+	text := defaultTemplate
+	if templateFile != "" {
+		content, err := os.ReadFile(templateFile)
+		if err != nil {
+			return fmt.Errorf("cannot read summary template %s: %w", templateFile, err)
+		}
+		text = string(content)
+	}
+
+	tmpl, err := template.New("summary").Parse(text)
+	if err != nil {
+		return fmt.Errorf("invalid summary template: %w", err)
+	}
+	// Rendered in full before printing, so summaries of organizations exported concurrently aren't interleaved
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return fmt.Errorf("failed to render summary: %w", err)
+	}
+	output.Printf("%s", rendered.String())
+	return nil
+}
@@ -0,0 +1,47 @@
+package variables
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Encodings CSV files can be written in with --output-encoding and read in with --input-encoding.
+// utf-16 is little-endian with a byte order mark, as written by Windows tools; on reading, the mark picks the byte order.
+var encodings = map[string]encoding.Encoding{
+	"utf-8":        unicode.UTF8,
+	"utf-16":       unicode.UTF16(unicode.LittleEndian, unicode.UseBOM),
+	"utf-16le":     unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM),
+	"utf-16be":     unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+	"latin-1":      charmap.ISO8859_1,
+	"windows-1252": charmap.Windows1252,
+}
+
+// Names of the supported encodings, in the order they are listed in messages
+var EncodingNames = []string{"utf-8", "utf-16", "utf-16le", "utf-16be", "latin-1", "windows-1252"}
+
+// Other names accepted for the supported encodings
+var encodingAliases = map[string]string{
+	"utf8":       "utf-8",
+	"latin1":     "latin-1",
+	"iso-8859-1": "latin-1",
+}
+
+// Returns the encoding of the given name, matched case-insensitively, or nil for UTF-8, which needs no transcoding
+func LookupEncoding(name string) (encoding.Encoding, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := encodingAliases[name]; ok {
+		name = alias
+	}
+	if name == "" || name == "utf-8" {
+		return nil, nil
+	}
+	enc, ok := encodings[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported encoding %q: must be one of %s", name, strings.Join(EncodingNames, ", "))
+	}
+	return enc, nil
+}
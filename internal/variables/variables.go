@@ -0,0 +1,411 @@
+package variables
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mona-actions/gh-migrate-variables/internal/api"
+)
+
+// Columns written to and read from variables CSV files
+var Header = []string{"Name", "Value", "Scope", "Visibility", "SelectedRepositories", "Environment"}
+
+// Columns written by a names-only export, which leaves out values
+var NamesOnlyHeader = []string{"Name", "Scope", "Visibility", "Environment"}
+
+// Columns written by an export with --schema compat, in the order the secrets-migration tool uses: the owner and
+// repository of a variable in their own columns instead of a single Scope, followed by the variable itself
+var CompatHeader = []string{"Organization", "Repository", "Environment", "Name", "Value", "Visibility", "SelectedRepositories"}
+
+// Positions of the columns within a record
+const (
+	ColumnName = iota
+	ColumnValue
+	ColumnScope
+	ColumnVisibility
+	ColumnSelectedRepositories
+	ColumnEnvironment
+)
+
+// Returns the value of a column, or an empty string when an optional column is missing
+func Column(record []string, column int) string {
+	if column < len(record) {
+		return record[column]
+	}
+	return ""
+}
+
+// Matches names made only of alphanumeric characters and underscores, not starting with a number
+var namePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Checks a variable name against GitHub's naming rules
+func ValidateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid variable name %q: names may only contain alphanumeric characters and underscores and must not start with a number", name)
+	}
+	if strings.HasPrefix(strings.ToUpper(name), "GITHUB_") {
+		return fmt.Errorf("invalid variable name %q: names must not start with the GITHUB_ prefix", name)
+	}
+	return nil
+}
+
+// Checks that text is valid UTF-8 without control characters, which break many CSV consumers.
+// Tabs and line breaks are allowed, as multi-line values are quoted in CSV.
+func ValidateText(text string) error {
+	if !utf8.ValidString(text) {
+		return fmt.Errorf("contains invalid UTF-8")
+	}
+	for _, r := range text {
+		if unicode.IsControl(r) && r != '\t' && r != '\n' && r != '\r' {
+			return fmt.Errorf("contains control character %U", r)
+		}
+	}
+	return nil
+}
+
+// Columns every variables CSV file must have, before the optional SelectedRepositories and Environment
+var requiredColumns = len(Header[:ColumnSelectedRepositories])
+
+// Returns the row of the compat schema for a standard record of the given organization, matching CompatHeader
+func CompatRecord(record []string, organization string) []string {
+	repo := Column(record, ColumnScope)
+	if repo == api.EntityTypeOrg {
+		repo = ""
+	}
+	return []string{
+		organization,
+		repo,
+		Column(record, ColumnEnvironment),
+		Column(record, ColumnName),
+		Column(record, ColumnValue),
+		Column(record, ColumnVisibility),
+		Column(record, ColumnSelectedRepositories),
+	}
+}
+
+// Converts the rows of a compat schema file to standard records, or returns false when the header isn't that schema.
+// A row without a repository holds an organization variable. The organization column is left out, as sync writes
+// to the target organization. Columns the header doesn't name are kept after the standard ones.
+func fromCompat(header []string, records [][]string) ([]string, [][]string, bool) {
+	if slices.ContainsFunc(header, func(name string) bool { return strings.EqualFold(strings.TrimSpace(name), "Scope") }) {
+		return header, records, false
+	}
+	positions := make(map[string]int, len(CompatHeader))
+	compat := make(map[int]bool, len(CompatHeader))
+	for _, column := range CompatHeader {
+		position := slices.IndexFunc(header, func(name string) bool {
+			return strings.EqualFold(strings.TrimSpace(name), column)
+		})
+		if position < 0 {
+			return header, records, false
+		}
+		positions[column] = position
+		compat[position] = true
+	}
+
+	extra := func(row []string) []string {
+		var fields []string
+		for i := range header {
+			if !compat[i] {
+				fields = append(fields, Column(row, i))
+			}
+		}
+		return fields
+	}
+	for i, record := range records {
+		scope := strings.TrimSpace(Column(record, positions["Repository"]))
+		if scope == "" {
+			scope = api.EntityTypeOrg
+		}
+		standard := []string{
+			Column(record, positions["Name"]),
+			Column(record, positions["Value"]),
+			scope,
+			Column(record, positions["Visibility"]),
+			Column(record, positions["SelectedRepositories"]),
+			Column(record, positions["Environment"]),
+		}
+		records[i] = append(standard, extra(record)...)
+	}
+	return append(slices.Clone(Header), extra(header)...), records, true
+}
+
+// Reorders the columns of a file whose header names the standard columns in another order, as CSVs written by
+// other tools may, so they can be read by position. Files in the compat schema are converted to standard records.
+// Columns the header doesn't name are kept after the standard ones, in their original order. Files already in the
+// standard order, or whose header lacks a required column, are returned as they are.
+func MapColumns(header []string, records [][]string) ([]string, [][]string) {
+	if header, records, ok := fromCompat(header, records); ok {
+		return header, records
+	}
+	positions := make([]int, len(Header))
+	standard := make(map[int]bool, len(Header))
+	for i, column := range Header {
+		positions[i] = slices.IndexFunc(header, func(name string) bool {
+			return strings.EqualFold(strings.TrimSpace(name), column)
+		})
+		if positions[i] < 0 && i < requiredColumns {
+			return header, records
+		}
+		if positions[i] >= 0 {
+			standard[positions[i]] = true
+		}
+	}
+	// Reading by position already works when every column in a standard position is that standard column
+	inOrder := true
+	for i := range min(len(header), len(Header)) {
+		inOrder = inOrder && positions[i] == i
+	}
+	if inOrder {
+		return header, records
+	}
+
+	reorder := func(row []string) []string {
+		mapped := make([]string, len(Header), len(row)+len(Header))
+		for i, position := range positions {
+			if position >= 0 {
+				mapped[i] = Column(row, position)
+			}
+		}
+		for i, field := range row {
+			if !standard[i] {
+				mapped = append(mapped, field)
+			}
+		}
+		return mapped
+	}
+	for i, record := range records {
+		records[i] = reorder(record)
+	}
+	mappedHeader := reorder(header)
+	copy(mappedHeader, Header)
+	return mappedHeader, records
+}
+
+// Prefixes of qualified scopes, which name the kind of scope so that a repository called "organization" can't be
+// mistaken for the organization scope
+const (
+	QualifiedOrgPrefix  = "org:"
+	QualifiedRepoPrefix = "repo:"
+	QualifiedEnvPrefix  = "env:"
+)
+
+// Returns the qualified form of a scope: org:<organization>, repo:<repo>, or env:<repo>/<environment>
+func QualifyScope(scope, environment, organization string) string {
+	switch {
+	case scope == api.EntityTypeOrg:
+		return QualifiedOrgPrefix + organization
+	case environment != "":
+		return QualifiedEnvPrefix + scope + "/" + environment
+	default:
+		return QualifiedRepoPrefix + scope
+	}
+}
+
+// Rewrites a record's qualified scope into the plain Scope and Environment columns, leaving plain scopes as they are.
+// The organization named in an org: scope is the source organization, so it is dropped. A repository whose name
+// would read as the organization scope is written as owner/repo, or kept qualified when no owner is given.
+func UnqualifyRecord(record []string, owner string) ([]string, error) {
+	scope := strings.TrimSpace(Column(record, ColumnScope))
+	var plain, environment string
+	switch {
+	case strings.HasPrefix(scope, QualifiedOrgPrefix):
+		plain = api.EntityTypeOrg
+	case strings.HasPrefix(scope, QualifiedRepoPrefix):
+		plain = strings.TrimPrefix(scope, QualifiedRepoPrefix)
+	case strings.HasPrefix(scope, QualifiedEnvPrefix):
+		// Environment names can't contain slashes, so the environment follows the last one
+		separator := strings.LastIndex(scope, "/")
+		if separator < len(QualifiedEnvPrefix) {
+			return nil, fmt.Errorf("invalid scope %q: expected env:<repo>/<environment>", scope)
+		}
+		plain, environment = scope[len(QualifiedEnvPrefix):separator], scope[separator+1:]
+		if plain == "" || environment == "" {
+			return nil, fmt.Errorf("invalid scope %q: expected env:<repo>/<environment>", scope)
+		}
+		if existing := strings.TrimSpace(Column(record, ColumnEnvironment)); existing != "" && existing != environment {
+			return nil, fmt.Errorf("scope %q names environment %s, but the Environment column is %s", scope, environment, existing)
+		}
+	default:
+		return record, nil
+	}
+
+	// Plain scopes match the organization scope case-insensitively, so a repository named Organization is ambiguous too
+	if !strings.HasPrefix(scope, QualifiedOrgPrefix) && strings.EqualFold(plain, api.EntityTypeOrg) {
+		if owner == "" {
+			return record, nil
+		}
+		plain = owner + "/" + plain
+	}
+
+	if len(record) <= ColumnEnvironment && environment != "" {
+		record = append(record, make([]string, ColumnEnvironment+1-len(record))...)
+	}
+	record[ColumnScope] = plain
+	if environment != "" {
+		record[ColumnEnvironment] = environment
+	}
+	return record, nil
+}
+
+// Rewrites the qualified scopes of records in place, as UnqualifyRecord does
+func UnqualifyRecords(records [][]string, owner string) error {
+	for i, record := range records {
+		unqualified, err := UnqualifyRecord(record, owner)
+		if err != nil {
+			return fmt.Errorf("variable %s: %w", Column(record, ColumnName), err)
+		}
+		records[i] = unqualified
+	}
+	return nil
+}
+
+// Builds the key identifying a variable by its scope, environment, and name
+func Key(scope, environment, name string) string {
+	return scope + "/" + environment + "/" + name
+}
+
+// Builds the key identifying the variable in a record
+func RecordKey(record []string) string {
+	return Key(Column(record, ColumnScope), Column(record, ColumnEnvironment), Column(record, ColumnName))
+}
+
+// CaseCollision lists names in one scope and environment that differ only by case
+type CaseCollision struct {
+	Scope       string
+	Environment string
+	Names       []string
+}
+
+// CaseCollisions detects variable names that differ only by case within the same scope and environment.
+// GitHub treats such names as the same variable, so only the first of them can be created.
+type CaseCollisions struct {
+	index map[string]int
+	sets  []CaseCollision
+}
+
+// Creates an empty case collision detector
+func NewCaseCollisions() *CaseCollisions {
+	return &CaseCollisions{index: make(map[string]int)}
+}
+
+// Adds a variable name in a scope and environment
+func (c *CaseCollisions) Add(scope, environment, name string) {
+	key := Key(scope, environment, strings.ToUpper(name))
+	i, seen := c.index[key]
+	if !seen {
+		i = len(c.sets)
+		c.index[key] = i
+		c.sets = append(c.sets, CaseCollision{Scope: scope, Environment: environment})
+	}
+	if !slices.Contains(c.sets[i].Names, name) {
+		c.sets[i].Names = append(c.sets[i].Names, name)
+	}
+}
+
+// Returns the names that collide, in the order they were first added
+func (c *CaseCollisions) Collisions() []CaseCollision {
+	var collisions []CaseCollision
+	for _, set := range c.sets {
+		if len(set.Names) > 1 {
+			collisions = append(collisions, set)
+		}
+	}
+	return collisions
+}
+
+// Describes where a collision is, e.g. "my-repo/production"
+func (c CaseCollision) Location() string {
+	if c.Environment != "" {
+		return c.Scope + "/" + c.Environment
+	}
+	return c.Scope
+}
+
+// UTF-8 byte order mark, which spreadsheet applications such as Excel write at the start of CSV files
+var byteOrderMark = []byte{0xEF, 0xBB, 0xBF}
+
+// Reads a variables CSV file, returning its records without the header row
+func ReadCSV(path string) ([][]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open file %s: %v", path, err)
+	}
+	return ParseCSV(path, content)
+}
+
+// Reads a variables CSV file, returning its header row and its records
+func ReadCSVWithHeader(path string) ([]string, [][]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot open file %s: %v", path, err)
+	}
+	return ParseCSVWithHeader(path, content)
+}
+
+// Parses the content of a variables CSV file, returning its records without the header row.
+// A leading byte order mark and fully-empty records, such as Excel's trailing blank rows, are ignored.
+func ParseCSV(name string, content []byte) ([][]string, error) {
+	_, records, err := ParseCSVWithHeader(name, content)
+	return records, err
+}
+
+// Parses the content of a variables CSV file like ParseCSV, also returning the header row
+// so optional columns can be found by name
+func ParseCSVWithHeader(name string, content []byte) ([]string, [][]string, error) {
+	header, records, _, err := ParseCSVWithLines(name, content)
+	return header, records, err
+}
+
+// Parses the content of a variables CSV file like ParseCSVWithHeader, also returning the line each record starts on,
+// so problems can be reported where they are in the file
+func ParseCSVWithLines(name string, content []byte) ([]string, [][]string, []int, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(content, byteOrderMark)))
+	// Allow rows with a varying number of columns so optional columns can be omitted
+	reader.FieldsPerRecord = -1
+
+	var records [][]string
+	var lines []int
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("cannot read file %s: %v", name, err)
+		}
+		if isEmptyRecord(record) {
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		records = append(records, record)
+		lines = append(lines, line)
+	}
+
+	if len(records) == 0 {
+		return nil, nil, nil, nil
+	}
+	// Names-only columns don't line up with a full export, so reading them as one would misplace every field
+	if slices.Equal(records[0], NamesOnlyHeader) {
+		return nil, nil, nil, fmt.Errorf("file %s is a names-only export and has no variable values", name)
+	}
+	return records[0], records[1:], lines[1:], nil
+}
+
+// Reports whether every field of a record is empty
+func isEmptyRecord(record []string) bool {
+	for _, field := range record {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
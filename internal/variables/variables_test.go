@@ -0,0 +1,47 @@
+package variables
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseCSVWithLinesExcelFile(t *testing.T) {
+	// Saved from Excel: a byte order mark, CRLF line endings, a blank row in the middle, and trailing blank rows
+	content := []byte("\xEF\xBB\xBFName,Value,Scope,Visibility,SelectedRepositories,Environment\r\n" +
+		"API_URL,https://api.example.com,organization,all,,\r\n" +
+		",,,,,\r\n" +
+		"DEPLOY_REGION,us-east-1,webapp,,,production\r\n" +
+		",,,,,\r\n" +
+		"\r\n" +
+		",,,,\r\n")
+
+	header, records, lines, err := ParseCSVWithLines("variables.csv", content)
+	if err != nil {
+		t.Fatalf("ParseCSVWithLines() error = %v", err)
+	}
+	if header[0] != "Name" {
+		t.Errorf("header[0] = %q, want %q", header[0], "Name")
+	}
+	if !slices.Equal(header, Header) {
+		t.Errorf("header = %q, want %q", header, Header)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2: %q", len(records), records)
+	}
+	if records[0][ColumnName] != "API_URL" || records[1][ColumnName] != "DEPLOY_REGION" {
+		t.Errorf("record names = %q, %q, want API_URL, DEPLOY_REGION", records[0][ColumnName], records[1][ColumnName])
+	}
+	if want := []int{2, 4}; !slices.Equal(lines, want) {
+		t.Errorf("lines = %v, want %v", lines, want)
+	}
+}
+
+func TestParseCSVWithLinesOnlyBlankRows(t *testing.T) {
+	header, records, _, err := ParseCSVWithLines("variables.csv", []byte("\xEF\xBB\xBF,,,,\r\n\r\n,,,,\r\n"))
+	if err != nil {
+		t.Fatalf("ParseCSVWithLines() error = %v", err)
+	}
+	if header != nil || len(records) != 0 {
+		t.Errorf("ParseCSVWithLines() = %q, %q, want no header and no records", header, records)
+	}
+}
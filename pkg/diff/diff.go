@@ -0,0 +1,150 @@
+package diff
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mona-actions/gh-migrate-variables/internal/variables"
+	"github.com/pterm/pterm"
+	"github.com/spf13/viper"
+)
+
+// DiffVariables compares two exported CSV files and reports the variables that differ between them
+func DiffVariables() error {
+	fileA := viper.GetString("GHMV_DIFF_FILE_A")
+	fileB := viper.GetString("GHMV_DIFF_FILE_B")
+
+	if fileA == "" || fileB == "" {
+		return fmt.Errorf("two CSV files are required")
+	}
+
+	// Columns are found by header name, so files written by other tools can list them in any order
+	headerA, recordsA, err := variables.ReadCSVWithHeader(fileA)
+	if err != nil {
+		return err
+	}
+	_, recordsA = variables.MapColumns(headerA, recordsA)
+	headerB, recordsB, err := variables.ReadCSVWithHeader(fileB)
+	if err != nil {
+		return err
+	}
+	_, recordsB = variables.MapColumns(headerB, recordsB)
+	// Files exported with --qualified-scope are compared by their plain scopes, like any other export
+	if err := variables.UnqualifyRecords(recordsA, ""); err != nil {
+		return fmt.Errorf("%s: %w", fileA, err)
+	}
+	if err := variables.UnqualifyRecords(recordsB, ""); err != nil {
+		return fmt.Errorf("%s: %w", fileB, err)
+	}
+
+	// Values are compared byte for byte unless cosmetic differences are to be ignored
+	compare := valueComparison{
+		ignoreWhitespace: viper.GetBool("GHMV_DIFF_IGNORE_WHITESPACE"),
+		ignoreCase:       viper.GetBool("GHMV_DIFF_CASE_INSENSITIVE_VALUES"),
+	}
+
+	indexA := indexRecords(recordsA)
+	indexB := indexRecords(recordsB)
+
+	var onlyA, onlyB, changed int
+	rows := [][]string{{"Difference", "Scope", "Environment", "Name", "Detail"}}
+
+	// Variables only in A, or in both with different values or visibility, in the order of file A
+	for _, record := range recordsA {
+		key := variables.RecordKey(record)
+		other, ok := indexB[key]
+		if !ok {
+			rows = append(rows, row("only in A", record, ""))
+			onlyA++
+			continue
+		}
+		if detail := compareRecords(record, other, compare); detail != "" {
+			rows = append(rows, row("changed", record, detail))
+			changed++
+		}
+	}
+
+	// Variables only in B, in the order of file B
+	for _, record := range recordsB {
+		if _, ok := indexA[variables.RecordKey(record)]; !ok {
+			rows = append(rows, row("only in B", record, ""))
+			onlyB++
+		}
+	}
+
+	if len(rows) > 1 {
+		pterm.DefaultTable.WithHasHeader().WithData(rows).Render()
+	}
+
+	fmt.Printf("\n📊 Diff Summary:\n")
+	fmt.Printf("A: %s (%d variables)\n", fileA, len(indexA))
+	fmt.Printf("B: %s (%d variables)\n", fileB, len(indexB))
+	fmt.Printf("⬅️  Only in A: %d\n", onlyA)
+	fmt.Printf("➡️  Only in B: %d\n", onlyB)
+	fmt.Printf("🔀 Changed: %d\n", changed)
+
+	if onlyA+onlyB+changed > 0 {
+		fmt.Printf("\n🛑 Found %d differences\n", onlyA+onlyB+changed)
+		os.Exit(1)
+	}
+
+	fmt.Println("\n✅ No differences found!")
+	return nil
+}
+
+// Indexes records by scope, environment, and name, skipping records without the required columns
+func indexRecords(records [][]string) map[string][]string {
+	index := make(map[string][]string, len(records))
+	for _, record := range records {
+		if len(record) < 4 {
+			continue
+		}
+		index[variables.RecordKey(record)] = record
+	}
+	return index
+}
+
+// How values are compared, by default byte for byte
+type valueComparison struct {
+	// Leading and trailing whitespace is ignored
+	ignoreWhitespace bool
+
+	// Letter case is ignored
+	ignoreCase bool
+}
+
+// Reports whether two values are equal under the comparison
+func (c valueComparison) equal(a, b string) bool {
+	if c.ignoreWhitespace {
+		a, b = strings.TrimSpace(a), strings.TrimSpace(b)
+	}
+	if c.ignoreCase {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// Describes how two records of the same variable differ, or returns an empty string if they match
+func compareRecords(a, b []string, compare valueComparison) string {
+	var differences []string
+	if !compare.equal(variables.Column(a, variables.ColumnValue), variables.Column(b, variables.ColumnValue)) {
+		differences = append(differences, "value")
+	}
+	if variables.Column(a, variables.ColumnVisibility) != variables.Column(b, variables.ColumnVisibility) {
+		differences = append(differences, fmt.Sprintf("visibility %s → %s",
+			variables.Column(a, variables.ColumnVisibility), variables.Column(b, variables.ColumnVisibility)))
+	}
+	return strings.Join(differences, ", ")
+}
+
+// Builds a table row for a variable
+func row(difference string, record []string, detail string) []string {
+	return []string{
+		difference,
+		variables.Column(record, variables.ColumnScope),
+		variables.Column(record, variables.ColumnEnvironment),
+		variables.Column(record, variables.ColumnName),
+		detail,
+	}
+}
@@ -0,0 +1,90 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mona-actions/gh-migrate-variables/internal/output"
+	"github.com/pterm/pterm"
+)
+
+// File the combined report of a --dedup export is written to
+const dedupFileName = "variables_dedup.csv"
+
+// Columns of the combined report, one row for each distinct name and value
+var dedupHeader = []string{"Name", "Value", "Organizations", "Occurrences"}
+
+// A variable name and value, the identity of a variable in the combined report
+type namedValue struct {
+	name  string
+	value string
+}
+
+// A distinct name and value, with the organizations it was exported from and how many variables had it
+type dedupEntry struct {
+	namedValue
+	organizations []string
+	occurrences   int
+}
+
+// Collapses the variables exported from every organization into one entry for each distinct name and value.
+// Organizations are merged in the order they were requested, so the report doesn't depend on which finished first.
+func dedupVariables(results []*ExportResult) []*dedupEntry {
+	var entries []*dedupEntry
+	index := make(map[namedValue]*dedupEntry)
+	for _, result := range results {
+		if result == nil {
+			continue
+		}
+		for _, variable := range result.exported {
+			entry := index[variable]
+			if entry == nil {
+				entry = &dedupEntry{namedValue: variable}
+				index[variable] = entry
+				entries = append(entries, entry)
+			}
+			if n := len(entry.organizations); n == 0 || entry.organizations[n-1] != result.Organization {
+				entry.organizations = append(entry.organizations, result.Organization)
+			}
+			entry.occurrences++
+		}
+	}
+	return entries
+}
+
+// Writes the combined report of a --dedup export
+func writeDedupReport(results []*ExportResult, opts exportOptions) error {
+	entries := dedupVariables(results)
+
+	// Only the file's existence matters here, as the report is always CSV
+	file, err := openDestination(dedupFileName, exportOptions{noClobber: opts.noClobber})
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if err := writer.Write(dedupHeader); err != nil {
+		return fmt.Errorf("failed to write dedup report header: %w", err)
+	}
+	shared := 0
+	for _, entry := range entries {
+		if len(entry.organizations) > 1 {
+			shared++
+		}
+		row := []string{entry.name, entry.value, strings.Join(entry.organizations, ";"), strconv.Itoa(entry.occurrences)}
+		if err := writer.Write(row); err != nil {
+			return fmt.Errorf("failed to write dedup report: %w", err)
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write dedup report: %w", err)
+	}
+
+	pterm.Info.Printf("%d distinct variables, %d shared by more than one organization\n", len(entries), shared)
+	output.Printf("📄 Dedup report: %s\n", dedupFileName)
+	return nil
+}
@@ -0,0 +1,105 @@
+package export
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Object storage schemes accepted by --output-file, and the command that uploads standard input to each
+var objectStorageCommands = map[string][]string{
+	"s3://": {"aws", "s3", "cp", "-"},
+	"gs://": {"gcloud", "storage", "cp", "-"},
+}
+
+// Reports whether a destination is an object storage URL rather than a local path
+func isObjectStorage(path string) bool {
+	for scheme := range objectStorageCommands {
+		if strings.HasPrefix(path, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// Opens the destination an organization's output is written to: standard output, an object storage URL, or a local file
+func openDestination(path string, opts exportOptions) (io.WriteCloser, error) {
+	if path == "-" {
+		return nopCloser{dataOutput}, nil
+	}
+	for scheme, command := range objectStorageCommands {
+		if strings.HasPrefix(path, scheme) {
+			return startUpload(path, command)
+		}
+	}
+
+	perm := os.FileMode(0644)
+	if opts.outputFormat == outputFormatShell {
+		perm = 0755
+	}
+
+	// Creating the file exclusively also catches a file that appeared while variables were fetched
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if opts.noClobber {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_EXCL
+	}
+	file, err := os.OpenFile(path, flags, perm)
+	if errors.Is(err, fs.ErrExist) {
+		return nil, fmt.Errorf("output file %s already exists; remove it or run without --no-clobber", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot create file %s: %w", path, err)
+	}
+	return file, nil
+}
+
+// Leaves standard output open when the export is done with it
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// Streams output to an object storage upload command, which completes once the writer is closed
+type uploadWriter struct {
+	io.WriteCloser
+	cmd    *exec.Cmd
+	stderr bytes.Buffer
+	url    string
+}
+
+// Starts the upload command for an object storage URL, using the credentials its CLI is configured with
+func startUpload(url string, command []string) (*uploadWriter, error) {
+	upload := &uploadWriter{url: url}
+	upload.cmd = exec.Command(command[0], append(command[1:], url)...)
+	upload.cmd.Stderr = &upload.stderr
+
+	stdin, err := upload.cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("cannot upload to %s: %w", url, err)
+	}
+	upload.WriteCloser = stdin
+	if err := upload.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("cannot upload to %s: %s is required: %w", url, command[0], err)
+	}
+	return upload, nil
+}
+
+// Ends the input and waits for the upload to finish
+func (u *uploadWriter) Close() error {
+	closeErr := u.WriteCloser.Close()
+	if err := u.cmd.Wait(); err != nil {
+		return fmt.Errorf("failed to upload %s: %w: %s", u.url, err, strings.TrimSpace(u.stderr.String()))
+	}
+	if closeErr != nil {
+		return fmt.Errorf("failed to upload %s: %w", u.url, closeErr)
+	}
+	return nil
+}
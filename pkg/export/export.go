@@ -1,119 +1,1192 @@
 package export
 
 import (
-	"encoding/csv"
+	"errors"
 	"fmt"
 	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mona-actions/gh-migrate-variables/internal/api"
+	"github.com/mona-actions/gh-migrate-variables/internal/config"
+	"github.com/mona-actions/gh-migrate-variables/internal/output"
+	"github.com/mona-actions/gh-migrate-variables/internal/report"
+	"github.com/mona-actions/gh-migrate-variables/internal/summary"
+	"github.com/mona-actions/gh-migrate-variables/internal/variables"
 	"github.com/pterm/pterm"
 	"github.com/spf13/viper"
+	"golang.org/x/text/encoding"
 )
 
-func ExportVariables() error {
+const (
+	outputFormatCSV    = "csv"
+	outputFormatShell  = "sh"
+	outputFormatGitOps = "gitops"
+
+	schemaStandard = "standard"
+	schemaCompat   = "compat"
+
+	changeTypeNew     = "new"
+	changeTypeChanged = "changed"
+
+	validateOutputWarn   = "warn"
+	validateOutputReject = "reject"
+)
+
+// ExportReport captures the outcome of an export run across all organizations
+type ExportReport struct {
+	Organizations   []*ExportResult `json:"organizations"`
+	DurationSeconds float64         `json:"duration_seconds"`
+}
+
+// ExportResult captures the outcome of exporting a single organization
+type ExportResult struct {
+	Organization      string             `json:"organization"`
+	Inaccessible      bool               `json:"inaccessible,omitempty"`
+	OutputFile        string             `json:"output_file,omitempty"`
+	TotalRepositories int                `json:"total_repositories"`
+	Successful        int                `json:"successful_repositories"`
+	Failed            int                `json:"failed_repositories"`
+	ActionsDisabled   int                `json:"actions_disabled_repositories"`
+	VariablesExported int                `json:"variables_exported"`
+	Repositories      []RepositoryResult `json:"repositories"`
+	Conflicts         []NameConflict     `json:"conflicts,omitempty"`
+	Errors            []string           `json:"errors,omitempty"`
+
+	// Set when listing repositories failed partway, so only the repositories listed before the failure were exported
+	RepositoryListIncomplete bool `json:"repository_list_incomplete,omitempty"`
+
+	// Repositories skipped by --resume, as an interrupted export already wrote their variables
+	Resumed int `json:"resumed_repositories,omitempty"`
+
+	// Names and values of the exported variables, kept for the combined report of --dedup
+	exported []namedValue
+}
+
+// NameConflict records an organization variable shadowed by variables of the same name in repositories
+type NameConflict struct {
+	Name         string   `json:"name"`
+	Repositories []string `json:"repositories"`
+}
+
+// RepositoryResult captures the outcome of exporting a single repository
+type RepositoryResult struct {
+	Name            string `json:"name"`
+	Variables       int    `json:"variables"`
+	ActionsDisabled bool   `json:"actions_disabled,omitempty"`
+	Error           string `json:"error,omitempty"`
+}
+
+// Data available to export summary templates
+type exportSummary struct {
+	*ExportResult
+	TotalTime time.Duration
+}
+
+// Default summary printed after each organization is exported
+const defaultSummaryTemplate = `
+📊 Export Summary:
+🏢 Organization: {{.Organization}}
+Total repositories found: {{.TotalRepositories}}
+✅ Successfully processed: {{.Successful}} repositories
+❌ Failed to process: {{.Failed}} repositories
+{{- if .ActionsDisabled}}
+🚫 Skipped (Actions disabled): {{.ActionsDisabled}} repositories
+{{- end}}
+{{- if .RepositoryListIncomplete}}
+⚠️ Repository list incomplete: only the repositories listed before the failure were exported
+{{- end}}
+{{- if .Resumed}}
+⏩ Already exported before resuming: {{.Resumed}} repositories
+{{- end}}
+📝 Total variables exported: {{.VariablesExported}}
+📁 Output file: {{.OutputFile}}
+🕐 Total time: {{.TotalTime}}
+`
+
+// Serializes per-organization summaries, which may finish concurrently
+var summaryMu sync.Mutex
+
+// Data available to the combined summary of a multi-organization export
+type combinedSummary struct {
+	Organizations     int
+	Inaccessible      int
+	TotalRepositories int
+	Successful        int
+	Failed            int
+	ActionsDisabled   int
+	VariablesExported int
+	TotalTime         time.Duration
+}
+
+// Summary printed once every organization of a multi-organization export is done
+const combinedSummaryTemplate = `
+📊 Combined Export Summary:
+🏢 Organizations exported: {{.Organizations}}
+{{- if .Inaccessible}}
+🚫 Inaccessible organizations: {{.Inaccessible}}
+{{- end}}
+Total repositories found: {{.TotalRepositories}}
+✅ Successfully processed: {{.Successful}} repositories
+❌ Failed to process: {{.Failed}} repositories
+{{- if .ActionsDisabled}}
+🚫 Skipped (Actions disabled): {{.ActionsDisabled}} repositories
+{{- end}}
+📝 Total variables exported: {{.VariablesExported}}
+🕐 Total time: {{.TotalTime}}
+`
+
+// Prints totals across every organization of the run
+func printCombinedSummary(exportReport *ExportReport, start time.Time) {
+	data := combinedSummary{TotalTime: time.Since(start).Round(time.Second)}
+	for _, result := range exportReport.Organizations {
+		if result.Inaccessible {
+			data.Inaccessible++
+			continue
+		}
+		data.Organizations++
+		data.TotalRepositories += result.TotalRepositories
+		data.Successful += result.Successful
+		data.Failed += result.Failed
+		data.ActionsDisabled += result.ActionsDisabled
+		data.VariablesExported += result.VariablesExported
+	}
+	if err := summary.Print("", combinedSummaryTemplate, data); err != nil {
+		pterm.Error.Printf("Failed to print summary: %v\n", err)
+	}
+}
+
+// Writes the export report if a report file was requested
+func writeReport(exportReport *ExportReport, start time.Time) {
+	reportFile := viper.GetString("report-file")
+	if reportFile == "" {
+		return
+	}
+
+	exportReport.DurationSeconds = time.Since(start).Round(time.Millisecond).Seconds()
+	if err := report.Write(reportFile, exportReport); err != nil {
+		pterm.Error.Printf("Failed to write report: %v\n", err)
+		return
+	}
+	output.Printf("📄 Report file: %s\n", reportFile)
+}
+
+// Standard output, set aside for the exported data when writing to stdout
+var dataOutput *os.File
+
+// Sends exported data to standard output and all other output to standard error, so the data can be piped
+func UseStdout() {
+	dataOutput = os.Stdout
+	os.Stdout = os.Stderr
+}
+
+// Options shared by the export of every organization in a run
+type exportOptions struct {
+	token        string
+	hostname     string
+	repoSort     string
+	outputFormat string
+	baseline     map[string][]string
+
+	// Column layout of the CSV output: standard, or compat for the secrets-migration tool's layout
+	schema string
+
+	// Explains empty results that are likely due to secrets rather than variables
+	explain bool
+
+	// Restricts the scan to the repositories of this team, by slug
+	team string
+
+	// Leaves out repositories tagged with any of these topics
+	excludeTopics []string
+
+	// Leaves out the per-repository lines, keeping only warnings, errors, and the summary
+	compact bool
+
+	// Maximum number of repositories scanned concurrently within an organization
+	repoConcurrency int
+
+	// Maximum number of environments scanned concurrently within a repository
+	environmentConcurrency int
+
+	// Pause before starting each batch of repoBatchSize repositories, or zero to start them without pausing
+	repoBatchDelay time.Duration
+	repoBatchSize  int
+
+	// Longest time written variables are held in memory before being flushed to the output
+	flushInterval time.Duration
+
+	// Adds repository default branch and visibility columns to the CSV
+	withRepoMetadata bool
+
+	// Adds columns with when each variable was created and last updated
+	withTimestamps bool
+
+	// Organization variable visibilities to export, or all when empty
+	visibilityFilter []string
+
+	// Pattern variable values must match to be exported, or nil to export all values
+	valueFilter *regexp.Regexp
+
+	// Fails instead of overwriting an existing output file
+	noClobber bool
+
+	// Reports organization variables shadowed by repository or environment variables of the same name
+	detectConflicts bool
+
+	// Leaves variable values out of the CSV
+	namesOnly bool
+
+	// Writes the number of variables in each scope instead of the variables
+	metadataOnly bool
+
+	// Writes scopes as org:<name>, repo:<name>, or env:<repo>/<env> instead of organization or a bare repository name
+	qualifiedScope bool
+
+	// Checks each repository's Actions permissions before fetching its variables
+	onlyReposWithActions bool
+
+	// Keeps the names and values of exported variables for a combined report across organizations
+	dedup bool
+
+	// Continues an interrupted export, skipping the scopes its partial output file already holds
+	resume bool
+
+	// Spinner of the run, whose text shows progress through long fetches
+	spinner *pterm.SpinnerPrinter
+
+	// Destination of the output, a local path or object storage URL, instead of the default file name
+	outputFile string
+
+	// Warns about variables with empty values, or with strictEmptyValues leaves them out as errors
+	warnOnEmptyValue  bool
+	strictEmptyValues bool
+
+	// Whether variables with unsafe names or values are warned about or left out, or empty to skip the check
+	validateOutput string
+
+	// Encoding CSV output is transcoded to, or nil to write UTF-8, and its name as given
+	outputEncoding     encoding.Encoding
+	outputEncodingName string
+}
+
+// Splits a comma-separated list, dropping empty entries
+func parseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func ExportVariables(runtimeConfig config.RuntimeConfig) error {
 	start := time.Now()
-	spinner, _ := pterm.DefaultSpinner.Start("Exporting variables...")
+	// The spinner shares standard output with everything else printed, so it only runs on a terminal
+	var spinner *pterm.SpinnerPrinter
+	if output.IsTerminal() {
+		spinner = output.StartSpinner("Exporting variables...")
+	}
 	// Validate environment variables
-	organization := viper.GetString("source-organization")
+	organizations := parseList(viper.GetString("source-organization"))
 	token := viper.GetString("source-token")
 	hostname := viper.GetString("source-hostname")
 
-	if organization == "" || token == "" {
+	repoSort := viper.GetString("GHMV_REPO_SORT")
+	continueOnAuthError := viper.GetBool("GHMV_CONTINUE_ON_AUTH_ERROR")
+	outputFormat := viper.GetString("GHMV_OUTPUT_FORMAT")
+
+	if len(organizations) == 0 || token == "" {
 		return fmt.Errorf("missing required environment variables: GHMV_SOURCE_ORGANIZATION, GHMV_SOURCE_TOKEN, or VARIABLES_CSV_FILE")
 	}
+	// Short-lived tokens can expire partway through a long export, and are replaced by running this command
+	if command := viper.GetString("GHMV_SOURCE_TOKEN_COMMAND"); command != "" {
+		api.SetTokenCommand(token, command)
+	}
 
-	var allVariables []map[string]string
+	if repoSort != "" && !slices.Contains(api.RepositorySortOptions, repoSort) {
+		return fmt.Errorf("invalid repository sort %q: must be one of %s", repoSort, strings.Join(api.RepositorySortOptions, ", "))
+	}
 
-	// Fetch organization variables
-	pterm.Info.Printf("Fetching organization variables for %s...", organization)
-	orgVariables, err := api.FetchOrgVariables(organization, token, hostname)
+	if outputFormat != outputFormatCSV && outputFormat != outputFormatShell && outputFormat != outputFormatGitOps {
+		return fmt.Errorf("invalid output format %q: must be %s, %s, or %s", outputFormat, outputFormatCSV, outputFormatShell, outputFormatGitOps)
+	}
+
+	schema := viper.GetString("GHMV_SCHEMA")
+	if schema != schemaStandard && schema != schemaCompat {
+		return fmt.Errorf("invalid schema %q: must be %s or %s", schema, schemaStandard, schemaCompat)
+	}
+
+	visibilityFilter := parseList(viper.GetString("GHMV_VISIBILITY_FILTER"))
+	for _, visibility := range visibilityFilter {
+		if !slices.Contains(api.OrgVisibilityOptions, visibility) {
+			return fmt.Errorf("invalid visibility filter %q: must be one of %s", visibility, strings.Join(api.OrgVisibilityOptions, ", "))
+		}
+	}
+
+	var valueFilter *regexp.Regexp
+	if pattern := viper.GetString("GHMV_VALUE_FILTER"); pattern != "" {
+		var err error
+		if valueFilter, err = regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid value filter %q: %v", pattern, err)
+		}
+	}
+
+	outputEncodingName := viper.GetString("GHMV_OUTPUT_ENCODING")
+	outputEncoding, err := variables.LookupEncoding(outputEncodingName)
 	if err != nil {
-		pterm.Error.Printf("Warning: Failed to fetch organization variables: %v\n", err)
-	} else {
-		pterm.Success.Printf("Found %d organization variables\n", len(orgVariables))
-		allVariables = append(allVariables, orgVariables...)
+		return fmt.Errorf("invalid output encoding: %w", err)
+	}
+	if outputEncoding != nil && outputFormat != outputFormatCSV {
+		return fmt.Errorf("--output-encoding is only supported with the %s output format", outputFormatCSV)
+	}
+
+	validateOutput := viper.GetString("GHMV_VALIDATE_OUTPUT")
+	if validateOutput != "" && validateOutput != validateOutputWarn && validateOutput != validateOutputReject {
+		return fmt.Errorf("invalid output validation %q: must be %s or %s", validateOutput, validateOutputWarn, validateOutputReject)
+	}
+
+	if dataOutput != nil && summary.JSON() {
+		return fmt.Errorf("--summary-json can't be used with --stdout, as both write to standard output")
+	}
+
+	if dataOutput != nil && len(organizations) > 1 {
+		return fmt.Errorf("--stdout supports a single organization, got %d", len(organizations))
+	}
+
+	opts := exportOptions{
+		token:                  token,
+		hostname:               hostname,
+		repoSort:               repoSort,
+		outputFormat:           outputFormat,
+		schema:                 schema,
+		explain:                viper.GetBool("GHMV_EXPLAIN"),
+		team:                   viper.GetString("GHMV_TEAM"),
+		excludeTopics:          parseList(strings.ToLower(viper.GetString("GHMV_EXCLUDE_TOPICS"))),
+		compact:                viper.GetBool("GHMV_COMPACT"),
+		repoConcurrency:        runtimeConfig.RepoConcurrency,
+		environmentConcurrency: runtimeConfig.EnvironmentConcurrency,
+		repoBatchDelay:         runtimeConfig.RepoBatchDelay,
+		repoBatchSize:          runtimeConfig.RepoBatchSize,
+		flushInterval:          runtimeConfig.FlushInterval,
+		withRepoMetadata:       viper.GetBool("GHMV_WITH_REPO_METADATA"),
+		withTimestamps:         viper.GetBool("GHMV_WITH_TIMESTAMPS"),
+		visibilityFilter:       visibilityFilter,
+		valueFilter:            valueFilter,
+		validateOutput:         validateOutput,
+		outputEncoding:         outputEncoding,
+		outputEncodingName:     outputEncodingName,
+		onlyReposWithActions:   viper.GetBool("GHMV_ONLY_REPOS_WITH_ACTIONS"),
+		namesOnly:              viper.GetBool("GHMV_NAMES_ONLY"),
+		metadataOnly:           viper.GetBool("GHMV_EXPORT_METADATA_ONLY"),
+		qualifiedScope:         viper.GetBool("GHMV_QUALIFIED_SCOPE"),
+		dedup:                  viper.GetBool("GHMV_DEDUP"),
+		resume:                 viper.GetBool("GHMV_RESUME"),
+		detectConflicts:        viper.GetBool("GHMV_DETECT_CONFLICTS"),
+		noClobber:              viper.GetBool("GHMV_NO_CLOBBER"),
+		outputFile:             viper.GetString("GHMV_OUTPUT_FILE"),
+		spinner:                spinner,
+		warnOnEmptyValue:       viper.GetBool("GHMV_WARN_ON_EMPTY_VALUE") || viper.GetBool("GHMV_STRICT_EMPTY_VALUES"),
+		strictEmptyValues:      viper.GetBool("GHMV_STRICT_EMPTY_VALUES"),
+	}
+
+	if opts.outputFile != "" {
+		if dataOutput != nil {
+			return fmt.Errorf("--output-file can't be used with --stdout")
+		}
+		if len(organizations) > 1 {
+			return fmt.Errorf("--output-file supports a single organization, got %d", len(organizations))
+		}
+		// Object storage can't be created exclusively, so an existing object can't be detected reliably
+		if opts.noClobber && isObjectStorage(opts.outputFile) {
+			return fmt.Errorf("--no-clobber is only supported for local output files")
+		}
+		if isArchive(opts.outputFile) && opts.outputFormat != outputFormatCSV {
+			return fmt.Errorf("zip archives are only supported with the %s output format", outputFormatCSV)
+		}
+	}
+
+	// A directory of files per scope is written locally, for one organization at a time
+	if opts.outputFormat == outputFormatGitOps {
+		switch {
+		case dataOutput != nil:
+			return fmt.Errorf("--output-format %s writes a directory and can't be used with --stdout", outputFormatGitOps)
+		case isObjectStorage(opts.outputFile):
+			return fmt.Errorf("--output-format %s writes a local directory, not object storage", outputFormatGitOps)
+		case len(organizations) > 1:
+			return fmt.Errorf("--output-format %s supports a single organization, got %d", outputFormatGitOps, len(organizations))
+		}
+	}
+
+	if opts.namesOnly && opts.outputFormat != outputFormatCSV {
+		return fmt.Errorf("--names-only is only supported with the %s output format", outputFormatCSV)
+	}
+
+	if opts.qualifiedScope && opts.outputFormat != outputFormatCSV {
+		return fmt.Errorf("--qualified-scope is only supported with the %s output format", outputFormatCSV)
+	}
+
+	if opts.withTimestamps && opts.outputFormat != outputFormatCSV {
+		return fmt.Errorf("--with-timestamps is only supported with the %s output format", outputFormatCSV)
+	}
+
+	// The compat layout has a column per variable field and names the repository in its own column
+	if opts.schema == schemaCompat {
+		switch {
+		case opts.outputFormat != outputFormatCSV:
+			return fmt.Errorf("--schema %s is only supported with the %s output format", schemaCompat, outputFormatCSV)
+		case opts.namesOnly, opts.metadataOnly, opts.qualifiedScope:
+			return fmt.Errorf("--schema %s can't be used with --names-only, --export-metadata-only, or --qualified-scope", schemaCompat)
+		case opts.resume:
+			return fmt.Errorf("--resume is only supported with the %s schema", schemaStandard)
+		}
+	}
+
+	// Counts have no columns for names, values, or changes, so options shaping those don't apply
+	if opts.metadataOnly {
+		switch {
+		case opts.outputFormat != outputFormatCSV:
+			return fmt.Errorf("--export-metadata-only is only supported with the %s output format", outputFormatCSV)
+		case opts.namesOnly, opts.withRepoMetadata, opts.withTimestamps:
+			return fmt.Errorf("--export-metadata-only can't be used with --names-only, --with-repo-metadata, or --with-timestamps")
+		case viper.GetString("GHMV_BASELINE") != "":
+			return fmt.Errorf("--export-metadata-only can't be used with --baseline")
+		case isArchive(opts.outputFile):
+			return fmt.Errorf("--export-metadata-only can't be written to a zip archive")
+		}
+	}
+
+	// The combined report compares values across organizations, which names-only exports and counts leave out
+	if opts.dedup {
+		switch {
+		case len(organizations) < 2:
+			return fmt.Errorf("--dedup needs more than one organization, got %d", len(organizations))
+		case opts.namesOnly, opts.metadataOnly:
+			return fmt.Errorf("--dedup can't be used with --names-only or --export-metadata-only")
+		}
+	}
+
+	// Resuming appends to the local CSV file an interrupted run left, which needs every variable in order
+	if opts.resume {
+		switch {
+		case opts.outputFormat != outputFormatCSV, opts.metadataOnly:
+			return fmt.Errorf("--resume is only supported for %s exports of variables", outputFormatCSV)
+		case dataOutput != nil, isObjectStorage(opts.outputFile), isArchive(opts.outputFile):
+			return fmt.Errorf("--resume needs a local CSV output file")
+		case opts.noClobber:
+			return fmt.Errorf("--resume can't be used with --no-clobber")
+		case opts.outputEncoding != nil:
+			return fmt.Errorf("--resume is only supported with UTF-8 output")
+		case opts.detectConflicts, opts.dedup:
+			return fmt.Errorf("--resume can't be used with --detect-conflicts or --dedup, which compare every variable of the organization")
+		}
+	}
+
+	// Load a previous export to compare against, so only differences are emitted
+	if baselineFile := viper.GetString("GHMV_BASELINE"); baselineFile != "" {
+		baseline, err := loadBaseline(baselineFile)
+		if err != nil {
+			return fmt.Errorf("failed to load baseline: %w", err)
+		}
+		opts.baseline = baseline
+	}
+
+	// Export organizations concurrently, starting them in order; each writes to its own slot so results keep that order
+	results := make([]*ExportResult, len(organizations))
+	errs := make([]error, len(organizations))
+	semaphore := make(chan struct{}, runtimeConfig.OrgConcurrency)
+	var aborted atomic.Bool
+	var wg sync.WaitGroup
+	for i, organization := range organizations {
+		semaphore <- struct{}{}
+		// Don't start further organizations once one has failed outright
+		if aborted.Load() {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			results[i], errs[i] = exportOrganization(organization, opts, start)
+			if errs[i] != nil && !(continueOnAuthError && errors.Is(errs[i], api.ErrOrganizationNotAccessible)) {
+				aborted.Store(true)
+			}
+		}()
+	}
+	wg.Wait()
+
+	exportReport := &ExportReport{}
+	var failed, inaccessible, incomplete int
+	for i, organization := range organizations {
+		result, err := results[i], errs[i]
+		if result == nil {
+			continue
+		}
+		if err != nil {
+			// Inaccessible organizations are recorded and skipped when requested
+			if continueOnAuthError && errors.Is(err, api.ErrOrganizationNotAccessible) {
+				pterm.Warning.Printf("Skipping organization %s: %v\n", organization, err)
+				result.Inaccessible = true
+				result.Errors = append(result.Errors, err.Error())
+				exportReport.Organizations = append(exportReport.Organizations, result)
+				inaccessible++
+				continue
+			}
+			if spinner != nil {
+				spinner.Fail()
+			}
+			writeReport(exportReport, start)
+			return err
+		}
+		exportReport.Organizations = append(exportReport.Organizations, result)
+		failed += result.Failed
+		if result.RepositoryListIncomplete {
+			incomplete++
+		}
+	}
+	if opts.dedup {
+		if err := writeDedupReport(results, opts); err != nil {
+			pterm.Error.Printf("Failed to write dedup report: %v\n", err)
+		}
+	}
+	if summary.JSON() {
+		// One line per organization, including those without variables, so each can be piped to jq
+		for _, result := range exportReport.Organizations {
+			if err := summary.PrintJSON(result); err != nil {
+				pterm.Error.Printf("%v\n", err)
+			}
+		}
+	} else if len(organizations) > 1 {
+		printCombinedSummary(exportReport, start)
+	}
+	if spinner != nil {
+		spinner.Success()
+	}
+	writeReport(exportReport, start)
+
+	if inaccessible > 0 {
+		output.Printf("\n🛑 Export skipped %d inaccessible organizations.\n", inaccessible)
+		os.Exit(1)
 	}
 
-	// Fetch repositories
-	pterm.Info.Printf("Fetching repository list for %s...\n", organization)
-	repos, err := api.FetchAllRepositories(organization, token, hostname)
+	if incomplete > 0 {
+		output.Printf("\n🛑 Export could not list every repository of %d organizations. Some variables may not have been exported.\n", incomplete)
+		os.Exit(1)
+	}
+
+	if failed > 0 {
+		output.Printf("\n🛑 Export completed with some failures. Some variables may not have been exported.\n")
+		output.Printf("export completed with %d failed repositories", failed)
+		os.Exit(1)
+	}
+
+	output.Println("\n✅ Export completed successfully!")
+	return nil
+}
+
+// Exports the organization and repository variables of a single organization to its own CSV file
+func exportOrganization(organization string, opts exportOptions, start time.Time) (*ExportResult, error) {
+	result := &ExportResult{Organization: organization}
+	token, hostname := opts.token, opts.hostname
+
+	// Fail before fetching anything rather than after, when the output file would be overwritten
+	// Gitops exports write a directory, whose files are each checked as they are created
+	if opts.noClobber && dataOutput == nil && opts.outputFormat != outputFormatGitOps {
+		if outputFile := outputFileName(organization, opts); fileExists(outputFile) {
+			return result, fmt.Errorf("output file %s already exists; remove it or run without --no-clobber", outputFile)
+		}
+	}
+
+	// Repositories owned by a user account are exported too, but users have no organization variables
+	ownerType, err := api.FetchOwnerType(organization, token, hostname)
 	if err != nil {
-		return fmt.Errorf("failed to fetch repositories: %w", err)
+		return result, err
+	}
+	userAccount := ownerType == api.OwnerTypeUser
+	if userAccount && opts.team != "" {
+		return result, fmt.Errorf("--team can't be used with %s, which is a user account", organization)
+	}
+
+	// Fail fast if the organization doesn't exist or isn't accessible
+	if !userAccount {
+		if err := api.ValidateOrganization(organization, token, hostname); err != nil {
+			return result, err
+		}
+	}
+
+	// Variables are checked and written in batches as they are fetched, rather than held until the end
+	writer := newVariableWriter(organization, opts)
+	defer writer.close()
+
+	// Pick up where an interrupted export left off, keeping the scopes it finished writing
+	if opts.resume {
+		path := outputFileName(organization, opts)
+		point, err := readResumePoint(path, opts)
+		if err != nil {
+			return result, err
+		}
+		if point != nil {
+			if err := truncateToResumePoint(path, point); err != nil {
+				return result, err
+			}
+			writer.resume = point
+			writer.written = point.variables
+			pterm.Info.Printf("Resuming %s: %d variables in %d repositories already exported\n", path, point.variables, len(point.repositories))
+		}
+	}
+	conflicts := newConflictDetector()
+	collisions := variables.NewCaseCollisions()
+	emit := func(batch []map[string]string) error {
+		warnOnLargeValues(batch)
+		for _, variable := range batch {
+			collisions.Add(variable["Scope"], variable["Environment"], variable["Name"])
+		}
+		// Names-only exports leave values out, so empty ones don't propagate
+		if opts.warnOnEmptyValue && !opts.namesOnly {
+			batch = checkEmptyValues(batch, opts, result)
+		}
+		if opts.detectConflicts {
+			conflicts.add(batch)
+		}
+		if opts.validateOutput != "" {
+			batch = validateVariables(batch, opts, result)
+		}
+		// Keep only variables that are new or changed relative to the baseline
+		if opts.baseline != nil {
+			batch = filterAgainstBaseline(batch, opts.baseline)
+		}
+		if opts.dedup {
+			for _, variable := range batch {
+				result.exported = append(result.exported, namedValue{name: variable["Name"], value: variable["Value"]})
+			}
+		}
+		return writer.write(batch)
+	}
+
+	// The repository list doesn't depend on the organization variables, so it is fetched while they are.
+	// The channel is buffered so the listing can finish even when the export stops before reading it.
+	if opts.team != "" {
+		pterm.Info.Printf("Fetching repository list for team %s in %s...\n", opts.team, organization)
+	} else {
+		pterm.Info.Printf("Fetching repository list for %s...\n", organization)
+	}
+	type repositoryList struct {
+		repos []api.Repository
+		err   error
+	}
+	listed := make(chan repositoryList, 1)
+	go func() {
+		listConfig := api.RepositoryListConfig{Sort: opts.repoSort, UserAccount: userAccount, Team: opts.team}
+		repos, err := api.FetchAllRepositories(organization, token, listConfig, hostname)
+		listed <- repositoryList{repos: repos, err: err}
+	}()
+
+	// Fetch organization variables
+	if userAccount {
+		pterm.Info.Printf("%s is a user account, exporting repository variables only\n", organization)
+	} else if writer.resume != nil && writer.resume.orgDone {
+		pterm.Info.Printf("Skipping organization variables of %s, already exported\n", organization)
+	} else {
+		pterm.Info.Printf("Fetching organization variables for %s...", organization)
+		// Organizations with thousands of variables take many pages, so show the count as they arrive
+		orgVariables, err := api.FetchOrgVariablesWithProgress(organization, token, func(fetched, total int) {
+			if opts.spinner != nil {
+				opts.spinner.UpdateText(fmt.Sprintf("Exporting variables... %s: %d/%d organization variables fetched", organization, fetched, total))
+			}
+		}, hostname)
+		if opts.spinner != nil {
+			opts.spinner.UpdateText("Exporting variables...")
+		}
+		if err != nil {
+			if stopErr := stopOnFatalError(writer, err); stopErr != nil {
+				return result, stopErr
+			}
+			pterm.Error.Printf("Warning: Failed to fetch organization variables: %v\n", err)
+			result.Errors = append(result.Errors, fmt.Sprintf("organization variables: %v", err))
+		} else {
+			if !opts.compact {
+				pterm.Success.Printf("Found %d organization variables\n", len(orgVariables))
+			}
+			if len(orgVariables) == 0 && opts.explain {
+				explainEmpty(organization, "", opts)
+			}
+			if len(opts.visibilityFilter) > 0 {
+				orgVariables = filterByVisibility(orgVariables, opts.visibilityFilter)
+				pterm.Info.Printf("Exporting %d organization variables with visibility %s\n", len(orgVariables), strings.Join(opts.visibilityFilter, ", "))
+			}
+			if opts.valueFilter != nil {
+				orgVariables = filterByValue(orgVariables, opts.valueFilter)
+				pterm.Info.Printf("Exporting %d organization variables with values matching %s\n", len(orgVariables), opts.valueFilter)
+			}
+			if opts.metadataOnly {
+				err = writer.writeCount(api.EntityTypeOrg, len(orgVariables))
+			} else {
+				err = emit(orgVariables)
+			}
+			if err != nil {
+				return result, err
+			}
+		}
+	}
+
+	// Wait for the repository list, which was fetched alongside the organization variables. Either fetch
+	// failing leaves the other's result usable: organization variables are already written when listing fails.
+	list := <-listed
+	repos, err := list.repos, list.err
+	// Export the repositories listed before a failure, but count the run as failed since some are missing
+	if errors.Is(err, api.ErrRepositoryListIncomplete) {
+		pterm.Error.Printf("Warning: Failed to list all repositories, exporting the %d listed: %v\n", len(repos), err)
+		result.Errors = append(result.Errors, fmt.Sprintf("repositories: %v", err))
+		result.RepositoryListIncomplete = true
+	} else if err != nil {
+		return result, fmt.Errorf("failed to fetch repositories: %w", err)
 	}
 	pterm.Info.Printf("Found %d repositories\n", len(repos))
 
+	// Repositories tagged as templates, deprecated, and the like are left out by topic, which the listing includes
+	if len(opts.excludeTopics) > 0 {
+		listed := len(repos)
+		repos = slices.DeleteFunc(repos, func(repository api.Repository) bool {
+			return slices.ContainsFunc(repository.Topics, func(topic string) bool {
+				return slices.Contains(opts.excludeTopics, topic)
+			})
+		})
+		pterm.Info.Printf("Skipping %d repositories with topics %s\n", listed-len(repos), strings.Join(opts.excludeTopics, ", "))
+	}
+
+	// Limit the number of repositories scanned, following the repository listing order
+	if maxRepos := viper.GetInt("GHMV_MAX_REPOS"); maxRepos > 0 && len(repos) > maxRepos {
+		pterm.Info.Printf("Limiting export to the first %d repositories\n", maxRepos)
+		repos = repos[:maxRepos]
+	}
+	result.TotalRepositories = len(repos)
+
+	// Repositories finished before the interruption keep the variables already written
+	if writer.resume != nil {
+		repos = slices.DeleteFunc(repos, func(repository api.Repository) bool {
+			return writer.resume.repositories[repository.Name]
+		})
+		result.Resumed = result.TotalRepositories - len(repos)
+	}
+
+	// Fetch repositories concurrently, starting them in listing order; each writes to its own slot
+	// and signals when done, so variables are written in that order as soon as they are available
+	fetched := make([][]map[string]string, len(repos))
+	errs := make([]error, len(repos))
+	done := make([]chan struct{}, len(repos))
+	for i := range repos {
+		done[i] = make(chan struct{})
+	}
+	// Closed when the export returns, including when it stops early, so no further repositories are started
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		semaphore := make(chan struct{}, opts.repoConcurrency)
+		for i, repository := range repos {
+			// Throttled servers get a breather between batches of repositories
+			if opts.repoBatchDelay > 0 && i > 0 && i%opts.repoBatchSize == 0 {
+				select {
+				case <-time.After(opts.repoBatchDelay):
+				case <-stop:
+					return
+				}
+			}
+			select {
+			case semaphore <- struct{}{}:
+			case <-stop:
+				return
+			}
+			// A free slot and a stop can arrive together, and the stop wins
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			go func() {
+				defer close(done[i])
+				defer func() { <-semaphore }()
+				if !opts.compact {
+					pterm.Info.Printf("Querying Actions API for variables in %s...\n", repository.Name)
+				}
+				fetched[i], errs[i] = fetchRepositoryVariables(organization, repository.Name, opts)
+			}()
+		}
+	}()
+
 	// Process each repository
-	var successful, failed int
-	for _, repo := range repos {
-		pterm.Info.Printf("Querying Actions API for variables in %s...\n", repo)
-		repoVariables, err := api.FetchRepoVariables(organization, repo, token, hostname)
+	for i, repository := range repos {
+		<-done[i]
+		repo := repository.Name
+		repoVariables, err := fetched[i], errs[i]
+		// Release the variables once written, so memory use doesn't grow with the organization
+		fetched[i] = nil
+		// Repositories with Actions disabled have no variables, so they are neither successes nor failures
+		if errors.Is(err, api.ErrActionsDisabled) {
+			if !opts.compact {
+				pterm.Info.Printf("Skipping repository %s: GitHub Actions is disabled\n", repo)
+			}
+			result.Repositories = append(result.Repositories, RepositoryResult{Name: repo, ActionsDisabled: true})
+			result.ActionsDisabled++
+			continue
+		}
 		if err != nil {
+			if stopErr := stopOnFatalError(writer, err); stopErr != nil {
+				return result, stopErr
+			}
 			pterm.Error.Printf("Warning: Failed to fetch variables for repo %s: %v\n", repo, err)
-			failed++
+			result.Repositories = append(result.Repositories, RepositoryResult{Name: repo, Error: err.Error()})
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", repo, err))
+			result.Failed++
 			continue
 		}
 
-		if len(repoVariables) > 0 {
-			allVariables = append(allVariables, repoVariables...)
-			pterm.Success.Printf("Found %d variables in repository %s\n", len(repoVariables), repo)
-			successful++
+		// Attach repository attributes for the optional metadata columns
+		if opts.withRepoMetadata {
+			for _, variable := range repoVariables {
+				variable["DefaultBranch"] = repository.DefaultBranch
+				variable["RepositoryVisibility"] = repository.Visibility
+			}
+		}
+
+		// Counts and rows only cover the variables whose value matches
+		if opts.valueFilter != nil {
+			repoVariables = filterByValue(repoVariables, opts.valueFilter)
+		}
+
+		// Emitted even when empty, so variables written earlier are still flushed on time
+		if opts.metadataOnly {
+			err = writer.writeCount(repo, len(repoVariables))
 		} else {
-			successful++
+			err = emit(repoVariables)
+		}
+		if err != nil {
+			return result, err
 		}
+		if len(repoVariables) > 0 && !opts.compact {
+			pterm.Success.Printf("Found %d variables in repository %s\n", len(repoVariables), repo)
+		} else if len(repoVariables) == 0 && opts.explain {
+			explainEmpty(organization, repo, opts)
+		}
+		result.Repositories = append(result.Repositories, RepositoryResult{Name: repo, Variables: len(repoVariables)})
+		result.Successful++
+	}
+
+	if err := writer.close(); err != nil {
+		return result, err
+	}
+
+	for _, conflict := range conflicts.conflicts {
+		pterm.Warning.Printf("Organization variable %s is shadowed by repository variables in: %s\n", conflict.Name, strings.Join(conflict.Repositories, ", "))
+	}
+	result.Conflicts = conflicts.conflicts
+
+	// GitHub keeps names unique regardless of case, so collisions point at data that won't sync cleanly
+	for _, collision := range collisions.Collisions() {
+		pterm.Warning.Printf("Variables %s in %s differ only by case and can't all be synced\n", strings.Join(collision.Names, ", "), collision.Location())
 	}
 
-	// Exit if no variables found
-	if len(allVariables) == 0 {
-		pterm.Info.Println("No variables found to export.")
+	if opts.baseline != nil {
+		pterm.Info.Printf("Found %d new or changed variables compared to the baseline\n", writer.written)
+	}
+
+	// No file is written if no variables were found, except for counts, where empty repositories matter too
+	if writer.written == 0 && !(opts.metadataOnly && writer.path != "") {
+		pterm.Info.Printf("No variables found to export for %s.\n", organization)
+		return result, nil
+	}
+	result.VariablesExported = writer.written
+	result.OutputFile = writer.path
+
+	// A JSON summary is printed once every organization is done
+	if summary.JSON() {
+		return result, nil
+	}
+
+	// Print summary
+	data := exportSummary{ExportResult: result, TotalTime: time.Since(start).Round(time.Second)}
+	summaryMu.Lock()
+	defer summaryMu.Unlock()
+	if err := summary.Print(viper.GetString("GHMV_SUMMARY_TEMPLATE"), defaultSummaryTemplate, data); err != nil {
+		pterm.Error.Printf("Failed to print summary: %v\n", err)
+	}
+
+	return result, nil
+}
+
+// Stops the export when a call failed in a way every remaining call would too: the rate limit is exhausted until
+// after it would time out, or the token expired or was never valid. The variables written so far are kept, so a CSV export can be
+// continued with --resume.
+func stopOnFatalError(writer *variableWriter, err error) error {
+	var exhausted *api.RateLimitExhaustedError
+	if !errors.As(err, &exhausted) && !errors.Is(err, api.ErrTokenExpired) && !errors.Is(err, api.ErrTokenUnauthorized) {
 		return nil
 	}
+	if closeErr := writer.close(); closeErr != nil {
+		pterm.Error.Printf("%v\n", closeErr)
+	}
+	return fmt.Errorf("export stopped: %w", err)
+}
+
+// Explains that an organization or repository without variables may hold secrets instead, which this tool doesn't migrate.
+// Only the number of secrets is read, never their names or values.
+func explainEmpty(organization, repo string, opts exportOptions) {
+	target := "Organization " + organization
+	if repo != "" {
+		target = "Repository " + repo
+	}
 
-	// Create and write to CSV file
-	outputFile := organization + "_variables.csv"
-	file, err := os.Create(outputFile)
+	if count, err := api.CountSecrets(organization, repo, opts.token, opts.hostname); err == nil && count > 0 {
+		pterm.Info.Printf("%s has no variables but has %d Actions secrets. This tool migrates variables only; secrets are not exported.\n", target, count)
+	}
+	// Dependabot is configured with secrets of its own, which are easily taken for Dependabot variables
+	if count, err := api.CountDependabotSecrets(organization, repo, opts.token, opts.hostname); err == nil && count > 0 {
+		pterm.Info.Printf("%s has no variables but has %d Dependabot secrets. GitHub has no Dependabot variables, and Dependabot secrets are not exported.\n", target, count)
+	}
+}
+
+// Returns the name of an organization's output file for the requested format, unless a destination was given
+func outputFileName(organization string, opts exportOptions) string {
+	if opts.outputFile != "" {
+		return opts.outputFile
+	}
+	if opts.metadataOnly {
+		return organization + "_variable_counts.csv"
+	}
+	if opts.outputFormat == outputFormatShell {
+		return organization + "_variables.sh"
+	}
+	if opts.outputFormat == outputFormatGitOps {
+		return gitopsDirectory
+	}
+	return organization + "_variables.csv"
+}
+
+// Reports whether a file exists at the given path
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Fetches the variables of a repository and its environments
+func fetchRepositoryVariables(organization, repo string, opts exportOptions) ([]map[string]string, error) {
+	// Check whether Actions is enabled first, so disabled repositories cost one request
+	if opts.onlyReposWithActions {
+		enabled, err := api.IsActionsEnabled(organization, repo, opts.token, opts.hostname)
+		if err != nil {
+			pterm.Warning.Printf("Could not check Actions permissions for %s, fetching its variables anyway: %v\n", repo, err)
+		} else if !enabled {
+			return nil, fmt.Errorf("repository %s: %w", repo, api.ErrActionsDisabled)
+		}
+	}
+
+	repoVariables, err := api.FetchRepoVariables(organization, repo, opts.token, opts.hostname)
+	if err != nil {
+		return nil, err
+	}
+	envVariables, err := fetchEnvironmentVariables(organization, repo, opts)
+	if err != nil {
+		return nil, err
+	}
+	return append(repoVariables, envVariables...), nil
+}
+
+// Fetches the variables of every environment in a repository, scanning a bounded number of environments concurrently
+func fetchEnvironmentVariables(organization, repo string, opts exportOptions) ([]map[string]string, error) {
+	environments, err := api.FetchRepoEnvironments(organization, repo, opts.token, opts.hostname)
 	if err != nil {
-		return fmt.Errorf("cannot create file %s: %w", outputFile, err)
+		return nil, err
+	}
+
+	// Each environment writes to its own slot, so results merge without locking and keep their order
+	results := make([][]map[string]string, len(environments))
+	errs := make([]error, len(environments))
+	semaphore := make(chan struct{}, opts.environmentConcurrency)
+	var wg sync.WaitGroup
+	for i, env := range environments {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			results[i], errs[i] = api.FetchEnvVariables(organization, repo, env, opts.token, opts.hostname)
+		}()
 	}
-	defer file.Close()
+	wg.Wait()
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
 
-	// Write header
-	if err := writer.Write([]string{"Name", "Value", "Scope", "Visibility"}); err != nil {
-		return fmt.Errorf("failed to write CSV header: %w", err)
+	var envVariables []map[string]string
+	for _, result := range results {
+		envVariables = append(envVariables, result...)
 	}
+	return envVariables, nil
+}
 
-	// Write variables
-	variablesWritten := 0
+// Returns the variables whose visibility is one of the given visibilities
+func filterByVisibility(allVariables []map[string]string, visibilities []string) []map[string]string {
+	var filtered []map[string]string
 	for _, variable := range allVariables {
-		if name, ok := variable["Name"]; ok && name != "" {
-			value := variable["Value"]
-			scope := variable["Scope"]
-			visibility := variable["Visibility"]
-			if err := writer.Write([]string{name, value, scope, visibility}); err != nil {
-				return fmt.Errorf("failed to write variable to CSV: %w", err)
-			}
-			variablesWritten++
+		if slices.Contains(visibilities, variable["Visibility"]) {
+			filtered = append(filtered, variable)
 		}
 	}
-	spinner.Success()
-	// Print summary
-	fmt.Printf("\n📊 Export Summary:\n")
-	fmt.Printf("Total repositories found: %d\n", len(repos))
-	fmt.Printf("✅ Successfully processed: %d repositories\n", successful)
-	fmt.Printf("❌ Failed to process: %d repositories\n", failed)
-	fmt.Printf("📝 Total variables exported: %d\n", variablesWritten)
-	fmt.Printf("📁 Output file: %s\n", outputFile)
-	fmt.Printf("🕐 Total time: %v\n", time.Since(start).Round(time.Second))
+	return filtered
+}
 
-	if failed > 0 {
-		fmt.Printf("\n🛑 Export completed with some failures. Some variables may not have been exported.\n")
-		fmt.Printf("export completed with %d failed repositories", failed)
-		os.Exit(1)
+// Returns the variables whose value matches the pattern
+func filterByValue(allVariables []map[string]string, pattern *regexp.Regexp) []map[string]string {
+	var filtered []map[string]string
+	for _, variable := range allVariables {
+		if pattern.MatchString(variable["Value"]) {
+			filtered = append(filtered, variable)
+		}
 	}
+	return filtered
+}
 
-	fmt.Println("\n✅ Export completed successfully!")
-	return nil
+// Finds organization variables whose names are also used by repository or environment variables,
+// which take precedence at runtime. Names are compared case-insensitively, as GitHub does.
+// Variables are added batch by batch, with organization variables first.
+type conflictDetector struct {
+	orgNames  map[string]string
+	index     map[string]int
+	conflicts []NameConflict
+}
+
+func newConflictDetector() *conflictDetector {
+	return &conflictDetector{orgNames: make(map[string]string), index: make(map[string]int)}
+}
+
+// Records the organization variables of a batch and any repository variables shadowing them
+func (d *conflictDetector) add(batch []map[string]string) {
+	for _, variable := range batch {
+		key := strings.ToUpper(variable["Name"])
+		if variable["Scope"] == api.EntityTypeOrg {
+			d.orgNames[key] = variable["Name"]
+			continue
+		}
+		orgName, ok := d.orgNames[key]
+		if !ok {
+			continue
+		}
+
+		location := variable["Scope"]
+		if env := variable["Environment"]; env != "" {
+			location += "/" + env
+		}
+		i, seen := d.index[key]
+		if !seen {
+			i = len(d.conflicts)
+			d.index[key] = i
+			d.conflicts = append(d.conflicts, NameConflict{Name: orgName})
+		}
+		d.conflicts[i].Repositories = append(d.conflicts[i].Repositories, location)
+	}
+}
+
+// Warns about variable values approaching GitHub's size limit, which may fail to sync elsewhere
+func warnOnLargeValues(allVariables []map[string]string) {
+	threshold := api.MaxVariableValueSize * 9 / 10
+	for _, variable := range allVariables {
+		if size := len(variable["Value"]); size >= threshold {
+			pterm.Warning.Printf("Variable %s in %s is %d bytes, close to GitHub's %d byte limit\n",
+				variable["Name"], variable["Scope"], size, api.MaxVariableValueSize)
+		}
+	}
+}
+
+// Warns about variables with empty values, which are often never-populated mistakes,
+// or with strict empty values, leaves them out of the output and records them as errors
+func checkEmptyValues(allVariables []map[string]string, opts exportOptions, result *ExportResult) []map[string]string {
+	var kept []map[string]string
+	for _, variable := range allVariables {
+		if variable["Value"] != "" {
+			kept = append(kept, variable)
+			continue
+		}
+
+		if opts.strictEmptyValues {
+			pterm.Error.Printf("Leaving out variable %s in %s: value is empty\n", variable["Name"], variable["Scope"])
+			result.Errors = append(result.Errors, fmt.Sprintf("%s/%s: value is empty", variable["Scope"], variable["Name"]))
+			continue
+		}
+		pterm.Warning.Printf("Variable %s in %s has an empty value\n", variable["Name"], variable["Scope"])
+		kept = append(kept, variable)
+	}
+	return kept
+}
+
+// Checks variable names and values for bytes that break CSV consumers, warning about them
+// or, in reject mode, leaving them out of the output and recording them as errors
+func validateVariables(allVariables []map[string]string, opts exportOptions, result *ExportResult) []map[string]string {
+	var valid []map[string]string
+	for _, variable := range allVariables {
+		var err error
+		if nameErr := variables.ValidateText(variable["Name"]); nameErr != nil {
+			err = fmt.Errorf("name %w", nameErr)
+		} else if valueErr := variables.ValidateText(variable["Value"]); valueErr != nil && !opts.namesOnly {
+			err = fmt.Errorf("value %w", valueErr)
+		}
+		if err == nil {
+			valid = append(valid, variable)
+			continue
+		}
+
+		if opts.validateOutput == validateOutputReject {
+			pterm.Error.Printf("Leaving out variable %q in %s: %v\n", variable["Name"], variable["Scope"], err)
+			result.Errors = append(result.Errors, fmt.Sprintf("%s/%s: %v", variable["Scope"], variable["Name"], err))
+			continue
+		}
+		pterm.Warning.Printf("Variable %q in %s: %v\n", variable["Name"], variable["Scope"], err)
+		valid = append(valid, variable)
+	}
+	return valid
+}
+
+// Loads a previously exported CSV, keyed by scope, environment, and variable name
+func loadBaseline(path string) (map[string][]string, error) {
+	header, records, err := variables.ReadCSVWithHeader(path)
+	if err != nil {
+		return nil, err
+	}
+	// A baseline exported with --schema compat, or with its columns in another order, is read by column name
+	_, records = variables.MapColumns(header, records)
+	// A baseline exported with --qualified-scope is matched by its plain scopes
+	if err := variables.UnqualifyRecords(records, ""); err != nil {
+		return nil, err
+	}
+
+	baseline := make(map[string][]string, len(records))
+	for _, record := range records {
+		if len(record) < 4 {
+			continue
+		}
+		baseline[variables.RecordKey(record)] = record
+	}
+	return baseline, nil
+}
+
+// Returns the variables that are new or whose value or visibility differ from the baseline, tagging each with its change type
+func filterAgainstBaseline(allVariables []map[string]string, baseline map[string][]string) []map[string]string {
+	var changed []map[string]string
+	for _, variable := range allVariables {
+		previous, ok := baseline[variables.Key(variable["Scope"], variable["Environment"], variable["Name"])]
+		switch {
+		case !ok:
+			variable["ChangeType"] = changeTypeNew
+		case previous[variables.ColumnValue] != variable["Value"] || previous[variables.ColumnVisibility] != variable["Visibility"]:
+			variable["ChangeType"] = changeTypeChanged
+		default:
+			continue
+		}
+		changed = append(changed, variable)
+	}
+	return changed
 }
@@ -0,0 +1,141 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mona-actions/gh-migrate-variables/internal/api"
+	"gopkg.in/yaml.v3"
+)
+
+// Directory the files of a gitops export are written to, unless --output-file names another
+const gitopsDirectory = "variables"
+
+// File holding the organization's variables in a gitops export
+const gitopsOrgFile = "org.yaml"
+
+// A scope's variables, as written to its YAML file in a gitops export
+type gitopsFile struct {
+	Organization string              `yaml:"organization"`
+	Repository   string              `yaml:"repository,omitempty"`
+	Variables    []gitopsVariable    `yaml:"variables,omitempty"`
+	Environments []gitopsEnvironment `yaml:"environments,omitempty"`
+}
+
+// A variable in a gitops file. Only organization variables have a visibility and selected repositories.
+type gitopsVariable struct {
+	Name                 string   `yaml:"name"`
+	Value                string   `yaml:"value"`
+	Visibility           string   `yaml:"visibility,omitempty"`
+	SelectedRepositories []string `yaml:"selected_repositories,omitempty"`
+}
+
+// The variables of a deployment environment, listed in its repository's file
+type gitopsEnvironment struct {
+	Name      string           `yaml:"name"`
+	Variables []gitopsVariable `yaml:"variables"`
+}
+
+// Writes a YAML file per scope into a directory laid out for a configuration repository: org.yaml for the
+// organization's variables, and <repo>.yaml for each repository's variables, including its environments.
+// Variables arrive grouped by scope, so each file is written once the next scope starts.
+type gitopsWriter struct {
+	dir          string
+	organization string
+	opts         exportOptions
+
+	// File of the scope being collected
+	file *gitopsFile
+}
+
+func newGitOpsWriter(dir, organization string, opts exportOptions) (*gitopsWriter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("cannot create directory %s: %w", dir, err)
+	}
+	return &gitopsWriter{dir: dir, organization: organization, opts: opts}, nil
+}
+
+// Adds a variable to its scope's file, writing the previous scope's file when a new scope starts
+func (g *gitopsWriter) add(variable map[string]string) error {
+	scope := variable["Scope"]
+	if g.file != nil && g.scope() != scope {
+		if err := g.flush(); err != nil {
+			return err
+		}
+	}
+	if g.file == nil {
+		g.file = &gitopsFile{Organization: g.organization}
+		if scope != api.EntityTypeOrg {
+			g.file.Repository = scope
+		}
+	}
+
+	entry := gitopsVariable{Name: variable["Name"], Value: variable["Value"]}
+	if scope == api.EntityTypeOrg {
+		entry.Visibility = variable["Visibility"]
+		if selected := variable["SelectedRepositories"]; selected != "" {
+			entry.SelectedRepositories = strings.Split(selected, api.SelectedRepositoriesSeparator)
+		}
+	}
+
+	env := variable["Environment"]
+	if env == "" {
+		g.file.Variables = append(g.file.Variables, entry)
+		return nil
+	}
+	for i := range g.file.Environments {
+		if g.file.Environments[i].Name == env {
+			g.file.Environments[i].Variables = append(g.file.Environments[i].Variables, entry)
+			return nil
+		}
+	}
+	g.file.Environments = append(g.file.Environments, gitopsEnvironment{Name: env, Variables: []gitopsVariable{entry}})
+	return nil
+}
+
+// Returns the scope of the file being collected
+func (g *gitopsWriter) scope() string {
+	if g.file.Repository == "" {
+		return api.EntityTypeOrg
+	}
+	return g.file.Repository
+}
+
+// Writes the file of the scope being collected
+func (g *gitopsWriter) flush() error {
+	if g.file == nil {
+		return nil
+	}
+	name := gitopsOrgFile
+	if g.file.Repository != "" {
+		// A repository named org would otherwise replace the organization's file
+		if strings.EqualFold(g.file.Repository+".yaml", gitopsOrgFile) {
+			return fmt.Errorf("repository %s can't be written to %s, which holds the organization's variables", g.file.Repository, gitopsOrgFile)
+		}
+		name = g.file.Repository + ".yaml"
+	}
+	path := filepath.Join(g.dir, name)
+
+	var content bytes.Buffer
+	encoder := yaml.NewEncoder(&content)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(g.file); err != nil {
+		return fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+	file, err := openDestination(path, g.opts)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(content.Bytes()); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", path, err)
+	}
+	g.file = nil
+	return nil
+}
@@ -0,0 +1,118 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+
+	"github.com/mona-actions/gh-migrate-variables/internal/api"
+	"github.com/mona-actions/gh-migrate-variables/internal/variables"
+)
+
+// Progress of an interrupted export, read back from the partial output file it left
+type resumePoint struct {
+	// Length of the file up to the end of the last complete scope, where writing continues
+	offset int64
+
+	// Whether the organization's variables were written completely
+	orgDone bool
+
+	// Repositories whose variables, including those of their environments, were written completely
+	repositories map[string]bool
+
+	// Number of variables kept from the partial file
+	variables int
+}
+
+// Reads the partial output file of an interrupted export, or returns nil when there is nothing to resume from.
+// Variables are written one scope at a time, so every scope but the last is complete. The last scope may have been
+// cut off by the interruption, so it is left out and exported again.
+func readResumePoint(path string, opts exportOptions) (*resumePoint, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s to resume from it: %w", path, err)
+	}
+
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	expected := csvHeader(opts)
+	if err != nil || !slices.Equal(header, expected) {
+		return nil, fmt.Errorf("%s wasn't written by an export with the same columns, so it can't be resumed", path)
+	}
+	scopeColumn := slices.Index(expected, "Scope")
+
+	point := &resumePoint{offset: reader.InputOffset(), repositories: make(map[string]bool)}
+	var lastScope string
+	var lastRows int
+	for {
+		start := reader.InputOffset()
+		record, err := reader.Read()
+		// A row cut off by the interruption ends the file without a line break, or can't be parsed at all
+		if err != nil || (reader.InputOffset() == int64(len(content)) && !bytes.HasSuffix(content, []byte("\n"))) {
+			break
+		}
+		scope, err := plainScope(variables.Column(record, scopeColumn))
+		if err != nil {
+			return nil, fmt.Errorf("%s can't be resumed: %w", path, err)
+		}
+		if scope != lastScope {
+			point.complete(lastScope, lastRows)
+			point.offset, lastScope, lastRows = start, scope, 0
+		}
+		lastRows++
+	}
+	return point, nil
+}
+
+// Records a scope as written completely
+func (p *resumePoint) complete(scope string, rows int) {
+	switch scope {
+	case "":
+		return
+	case api.EntityTypeOrg:
+		p.orgDone = true
+	default:
+		p.repositories[scope] = true
+	}
+	p.variables += rows
+}
+
+// Returns the repository a scope belongs to, or the organization scope, reading qualified scopes too
+func plainScope(scope string) (string, error) {
+	record := make([]string, variables.ColumnScope+1)
+	record[variables.ColumnScope] = scope
+	record, err := variables.UnqualifyRecord(record, "")
+	if err != nil {
+		return "", err
+	}
+	return record[variables.ColumnScope], nil
+}
+
+// Cuts an interrupted export's output file back to its last complete scope, so the rest can be appended
+func truncateToResumePoint(path string, point *resumePoint) error {
+	if err := os.Truncate(path, point.offset); err != nil {
+		return fmt.Errorf("cannot resume %s: %w", path, err)
+	}
+	return nil
+}
+
+// Opens a resumed export's output file for appending
+func openForAppend(path string) (io.WriteCloser, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open file %s: %w", path, err)
+	}
+	return file, nil
+}
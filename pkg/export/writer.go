@@ -0,0 +1,362 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mona-actions/gh-migrate-variables/internal/api"
+	"github.com/mona-actions/gh-migrate-variables/internal/variables"
+	"golang.org/x/text/transform"
+)
+
+// Writes an organization's variables as they are fetched, so an interrupted export leaves a usable partial file.
+// The output is only created once the first variable is written, so organizations without variables get no file.
+type variableWriter struct {
+	organization string
+	opts         exportOptions
+	path         string
+
+	output    io.WriteCloser
+	buffer    *bufio.Writer
+	csv       *csv.Writer
+	lastFlush time.Time
+
+	// Zip archive holding a CSV file per scope, and the scope of the file being written
+	archive *zip.Writer
+	entry   string
+
+	// Directory of YAML files, one per scope, for the gitops output format
+	gitops *gitopsWriter
+
+	// Number of variables written so far
+	written int
+
+	// Partial file of an interrupted export, which is appended to rather than overwritten
+	resume *resumePoint
+}
+
+func newVariableWriter(organization string, opts exportOptions) *variableWriter {
+	return &variableWriter{organization: organization, opts: opts}
+}
+
+// Writes a batch of variables, flushing them to the output once the flush interval has passed
+func (w *variableWriter) write(batch []map[string]string) error {
+	for _, variable := range batch {
+		if variable["Name"] == "" {
+			continue
+		}
+		if w.buffer == nil && w.gitops == nil {
+			if err := w.open(); err != nil {
+				return err
+			}
+		}
+		if err := w.writeVariable(variable); err != nil {
+			return err
+		}
+		w.written++
+	}
+
+	if w.buffer != nil && time.Since(w.lastFlush) >= w.opts.flushInterval {
+		return w.flush()
+	}
+	return nil
+}
+
+// Creates the output and writes the CSV header or script preamble
+func (w *variableWriter) open() error {
+	w.path = outputFileName(w.organization, w.opts)
+	if dataOutput != nil {
+		w.path = "-"
+	}
+	// Each scope's file is written to the directory once all its variables are collected
+	if w.opts.outputFormat == outputFormatGitOps {
+		gitops, err := newGitOpsWriter(w.path, w.organization, w.opts)
+		if err != nil {
+			return err
+		}
+		w.gitops = gitops
+		return nil
+	}
+	var output io.WriteCloser
+	var err error
+	if w.resume != nil {
+		output, err = openForAppend(w.path)
+	} else {
+		output, err = openDestination(w.path, w.opts)
+	}
+	if err != nil {
+		return err
+	}
+	w.output = output
+	w.buffer = bufio.NewWriter(output)
+	w.lastFlush = time.Now()
+
+	if w.opts.metadataOnly {
+		w.csv = csv.NewWriter(w.encode(w.buffer))
+		if err := w.csv.Write(metadataHeader); err != nil {
+			return fmt.Errorf("failed to write CSV header: %w", err)
+		}
+		return nil
+	}
+
+	if w.opts.outputFormat == outputFormatShell {
+		if _, err := w.buffer.WriteString(shellPreamble(w.organization)); err != nil {
+			return fmt.Errorf("failed to write shell script: %w", err)
+		}
+		return nil
+	}
+
+	// Each scope's file is started when its first variable is written
+	if isArchive(w.path) {
+		w.archive = zip.NewWriter(w.buffer)
+		return nil
+	}
+
+	w.csv = csv.NewWriter(w.encode(w.buffer))
+	// A resumed file already starts with the header
+	if w.resume != nil {
+		return nil
+	}
+	if err := w.csv.Write(csvHeader(w.opts)); err != nil {
+		return fmt.Errorf("failed to write CSV header: %w", err)
+	}
+	return nil
+}
+
+// Writes the number of variables in a scope, for metadata-only exports
+func (w *variableWriter) writeCount(scope string, count int) error {
+	if w.buffer == nil {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+	if w.opts.qualifiedScope {
+		scope = variables.QualifyScope(scope, "", w.organization)
+	}
+	if err := w.csv.Write([]string{scope, strconv.Itoa(count)}); err != nil {
+		return fmt.Errorf("failed to write variable count to CSV: %w", err)
+	}
+	w.written += count
+
+	if time.Since(w.lastFlush) >= w.opts.flushInterval {
+		return w.flush()
+	}
+	return nil
+}
+
+// Starts the archive's CSV file for a scope. Variables arrive grouped by scope, one repository at a time,
+// so each scope gets a single file.
+func (w *variableWriter) openEntry(scope string) error {
+	if w.csv != nil {
+		w.csv.Flush()
+		if err := w.csv.Error(); err != nil {
+			return fmt.Errorf("failed to write variable to CSV: %w", err)
+		}
+	}
+	entry, err := w.archive.Create(archiveEntryName(scope))
+	if err != nil {
+		return fmt.Errorf("failed to add %s to %s: %w", archiveEntryName(scope), w.path, err)
+	}
+	w.entry = scope
+	w.csv = csv.NewWriter(w.encode(entry))
+	if err := w.csv.Write(csvHeader(w.opts)); err != nil {
+		return fmt.Errorf("failed to write CSV header: %w", err)
+	}
+	return nil
+}
+
+// Transcodes CSV written to dst from UTF-8 to the output encoding, if one was requested
+func (w *variableWriter) encode(dst io.Writer) io.Writer {
+	if w.opts.outputEncoding == nil {
+		return dst
+	}
+	return transform.NewWriter(dst, w.opts.outputEncoding.NewEncoder())
+}
+
+// Writes a single variable as a CSV row or shell command
+func (w *variableWriter) writeVariable(variable map[string]string) error {
+	if w.gitops != nil {
+		return w.gitops.add(variable)
+	}
+	if w.archive != nil && (w.csv == nil || variable["Scope"] != w.entry) {
+		if err := w.openEntry(variable["Scope"]); err != nil {
+			return err
+		}
+	}
+	if w.csv == nil {
+		if _, err := w.buffer.WriteString(shellCommand(variable) + "\n"); err != nil {
+			return fmt.Errorf("failed to write shell script: %w", err)
+		}
+		return nil
+	}
+	row := csvRow(variable, w.organization, w.opts)
+	// A character the encoding can't represent would fail the write halfway through the row, so the variable is
+	// checked first and named in the error
+	if w.opts.outputEncoding != nil {
+		encoder := w.opts.outputEncoding.NewEncoder()
+		for _, field := range row {
+			if _, err := encoder.String(field); err != nil {
+				return fmt.Errorf("variable %s can't be written as %s: %w", variable["Name"], w.opts.outputEncodingName, err)
+			}
+		}
+	}
+	if err := w.csv.Write(row); err != nil {
+		return fmt.Errorf("failed to write variable to CSV: %w", err)
+	}
+	return nil
+}
+
+// Pushes buffered variables to the output
+func (w *variableWriter) flush() error {
+	if w.csv != nil {
+		w.csv.Flush()
+		if err := w.csv.Error(); err != nil {
+			return fmt.Errorf("failed to write variable to CSV: %w", err)
+		}
+	}
+	if w.archive != nil {
+		if err := w.archive.Flush(); err != nil {
+			return fmt.Errorf("failed to write %s: %w", w.path, err)
+		}
+	}
+	if err := w.buffer.Flush(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", w.path, err)
+	}
+	w.lastFlush = time.Now()
+	return nil
+}
+
+// Flushes any remaining variables and closes the output
+func (w *variableWriter) close() error {
+	if w.gitops != nil {
+		err := w.gitops.flush()
+		w.gitops = nil
+		return err
+	}
+	if w.buffer == nil {
+		return nil
+	}
+	err := w.flush()
+	// Closing the archive writes its directory, without which the archive can't be read
+	if w.archive != nil && err == nil {
+		if err = w.archive.Close(); err != nil {
+			err = fmt.Errorf("failed to write %s: %w", w.path, err)
+		} else if err = w.buffer.Flush(); err != nil {
+			err = fmt.Errorf("failed to write %s: %w", w.path, err)
+		}
+	}
+	if closeErr := w.output.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to close %s: %w", w.path, closeErr)
+	}
+	w.output, w.buffer, w.archive = nil, nil, nil
+	return err
+}
+
+// Reports whether output goes to a zip archive of per-repository CSV files
+func isArchive(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".zip")
+}
+
+// Returns the name of a scope's CSV file within an archive
+func archiveEntryName(scope string) string {
+	if scope == api.EntityTypeOrg {
+		return "organization.csv"
+	}
+	return "repositories/" + scope + ".csv"
+}
+
+// Columns of a metadata-only export, one row per scope
+var metadataHeader = []string{"Scope", "VariableCount"}
+
+// Returns the CSV header for the requested columns
+func csvHeader(opts exportOptions) []string {
+	header := slices.Clone(variables.Header)
+	if opts.schema == schemaCompat {
+		header = slices.Clone(variables.CompatHeader)
+	}
+	if opts.namesOnly {
+		header = slices.Clone(variables.NamesOnlyHeader)
+	}
+	if opts.withRepoMetadata {
+		header = append(header, "DefaultBranch", "RepositoryVisibility")
+	}
+	if opts.withTimestamps {
+		header = append(header, "CreatedAt", "UpdatedAt")
+	}
+	if opts.baseline != nil {
+		header = append(header, "ChangeType")
+	}
+	return header
+}
+
+// Returns the CSV row of a variable, matching csvHeader
+func csvRow(variable map[string]string, organization string, opts exportOptions) []string {
+	name := variable["Name"]
+	value := variable["Value"]
+	scope := variable["Scope"]
+	visibility := variable["Visibility"]
+	selectedRepos := variable["SelectedRepositories"]
+	environment := variable["Environment"]
+	if opts.qualifiedScope {
+		scope = variables.QualifyScope(scope, environment, organization)
+	}
+	row := []string{name, value, scope, visibility, selectedRepos, environment}
+	if opts.schema == schemaCompat {
+		row = variables.CompatRecord(row, organization)
+	}
+	if opts.namesOnly {
+		row = []string{name, scope, visibility, environment}
+	}
+	if opts.withRepoMetadata {
+		row = append(row, variable["DefaultBranch"], variable["RepositoryVisibility"])
+	}
+	if opts.withTimestamps {
+		row = append(row, variable["CreatedAt"], variable["UpdatedAt"])
+	}
+	if opts.baseline != nil {
+		row = append(row, variable["ChangeType"])
+	}
+	return row
+}
+
+// Returns the start of a shell script of `gh variable set` commands
+func shellPreamble(organization string) string {
+	var script strings.Builder
+	script.WriteString("#!/usr/bin/env bash\n")
+	script.WriteString("# Generated by gh-migrate-variables. Review before running.\n")
+	script.WriteString("# Set ORG to the target organization, and GH_HOST for GitHub Enterprise Server.\n")
+	script.WriteString("set -euo pipefail\n\n")
+	fmt.Fprintf(&script, "ORG=\"${ORG:-%s}\"\n\n", organization)
+	return script.String()
+}
+
+// Returns the `gh variable set` command that recreates a variable
+func shellCommand(variable map[string]string) string {
+	command := fmt.Sprintf("gh variable set %s --body %s", shellQuote(variable["Name"]), shellQuote(variable["Value"]))
+	if variable["Scope"] == api.EntityTypeOrg {
+		command += fmt.Sprintf(" --org \"$ORG\" --visibility %s", shellQuote(variable["Visibility"]))
+		if selected := variable["SelectedRepositories"]; variable["Visibility"] == api.VisibilitySelected && selected != "" {
+			repos := strings.ReplaceAll(selected, api.SelectedRepositoriesSeparator, ",")
+			command += fmt.Sprintf(" --repos %s", shellQuote(repos))
+		}
+	} else {
+		command += fmt.Sprintf(" --repo \"$ORG\"/%s", shellQuote(variable["Scope"]))
+		if env := variable["Environment"]; env != "" {
+			command += fmt.Sprintf(" --env %s", shellQuote(env))
+		}
+	}
+	return command
+}
+
+// Quotes a value for safe use as a single shell word
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -0,0 +1,237 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mona-actions/gh-migrate-variables/internal/api"
+	"github.com/mona-actions/gh-migrate-variables/internal/output"
+	"github.com/mona-actions/gh-migrate-variables/internal/report"
+	"github.com/pterm/pterm"
+	"github.com/spf13/viper"
+)
+
+// Actions a sync plan records for each variable
+const (
+	planActionCreate = "create"
+	planActionUpdate = "update"
+	planActionSkip   = "skip"
+	planActionFail   = "fail"
+)
+
+// Reason recorded for variables planned for update, which sync doesn't carry out
+const planReasonUpdate = "exists in the target with another value or visibility; sync only creates variables, " +
+	"so syncing it fails and applying the plan leaves it as it is: update it in the target instead"
+
+// How a variable compares with the target, as shown by a dry run with --diff-target
+const (
+	changeCreate = "create"
+	changeUpdate = "update"
+	changeNoOp   = "no-op"
+)
+
+// SyncPlan lists what a sync would do to each variable, written by a dry run with --report-file
+// so it can be reviewed and later applied as-is with --apply-plan
+type SyncPlan struct {
+	TargetOrganization string            `json:"target_organization"`
+	InputFile          string            `json:"input_file"`
+	CreatedAt          time.Time         `json:"created_at"`
+	Variables          []PlannedVariable `json:"variables"`
+}
+
+// PlannedVariable captures the resolved target and intended action of a single variable
+type PlannedVariable struct {
+	Name                 string   `json:"name"`
+	Value                string   `json:"value,omitempty"`
+	Scope                string   `json:"scope"`
+	Owner                string   `json:"owner,omitempty"`
+	Repository           string   `json:"repository,omitempty"`
+	Environment          string   `json:"environment,omitempty"`
+	Visibility           string   `json:"visibility,omitempty"`
+	SelectedRepositories []string `json:"selected_repositories,omitempty"`
+	Action               string   `json:"action"`
+	Reason               string   `json:"reason,omitempty"`
+
+	// How the variable compares with the target and the target's current value, recorded with --diff-target
+	Change      string `json:"change,omitempty"`
+	TargetValue string `json:"target_value,omitempty"`
+}
+
+// Builds the plan of a dry run from the outcome of each variable
+func buildPlan(result *SyncResult) *SyncPlan {
+	plan := &SyncPlan{
+		TargetOrganization: result.TargetOrganization,
+		InputFile:          result.InputFile,
+		CreatedAt:          time.Now().UTC(),
+	}
+	for _, variable := range result.Variables {
+		planned := PlannedVariable{
+			Name:        variable.Name,
+			Scope:       variable.Scope,
+			Environment: variable.Environment,
+			Visibility:  variable.Visibility,
+			Reason:      variable.Error,
+			Change:      variable.change,
+			TargetValue: variable.targetValue,
+		}
+		if variable.Scope != api.EntityTypeOrg && variable.Scope != "" {
+			planned.Owner, planned.Repository = parseRepositoryScope(variable.Scope, result.TargetOrganization)
+		} else {
+			planned.Owner = variable.Organization
+		}
+
+		switch variable.Status {
+		case statusDryRun:
+			planned.Action = planActionCreate
+			planned.Value = variable.value
+			planned.SelectedRepositories = variable.selectedRepos
+		case statusSkippedOrg:
+			planned.Action, planned.Reason = planActionSkip, "organization variables are skipped (--skip-org)"
+		case statusSkippedExisting:
+			planned.Action, planned.Reason = planActionSkip, "already exists in the target (--only-missing)"
+		case statusSkipped:
+			planned.Action = planActionSkip
+		case statusFailed:
+			planned.Action = planActionFail
+			if variable.needsUpdate {
+				planned.Action, planned.Reason = planActionUpdate, planReasonUpdate
+				planned.Value = variable.value
+				planned.SelectedRepositories = variable.selectedRepos
+			}
+		default:
+			planned.Action = planActionFail
+		}
+		plan.Variables = append(plan.Variables, planned)
+	}
+	return plan
+}
+
+// Compares a variable with its current state in the target, returning the change syncing it stands for and the
+// target's current value. Organization variables also compare their visibility. The change is empty when the
+// target couldn't be read.
+func compareWithTarget(orgSnapshots *orgSnapshotCache, repoSnapshot *api.VariableSnapshot, targetOrg, scope, environment, name, value, visibility string) (string, string) {
+	existing, found, err := targetVariable(orgSnapshots, repoSnapshot, targetOrg, scope, environment, name)
+	switch {
+	case err != nil:
+		return "", ""
+	case !found:
+		return changeCreate, ""
+	case existing["Value"] != value || (scope == api.EntityTypeOrg && existing["Visibility"] != visibility):
+		return changeUpdate, existing["Value"]
+	default:
+		return changeNoOp, existing["Value"]
+	}
+}
+
+// Prints each variable's value in the CSV beside its value in the target and the change between them
+func printTargetDiff(result *SyncResult) {
+	rows := [][]string{{"Change", "Scope", "Environment", "Name", "CSV Value", "Target Value"}}
+	var creates, updates, unchanged int
+	for _, variable := range result.Variables {
+		if variable.change == "" {
+			continue
+		}
+		targetValue := "(missing)"
+		switch variable.change {
+		case changeCreate:
+			creates++
+		case changeUpdate:
+			updates++
+			targetValue = strconv.Quote(variable.targetValue)
+		case changeNoOp:
+			unchanged++
+			targetValue = strconv.Quote(variable.targetValue)
+		}
+		scope := variable.Scope
+		if variable.Organization != "" {
+			scope += " " + variable.Organization
+		}
+		rows = append(rows, []string{variable.change, scope, variable.Environment, variable.Name, strconv.Quote(variable.value), targetValue})
+	}
+	if len(rows) > 1 {
+		pterm.DefaultTable.WithHasHeader().WithData(rows).Render()
+	}
+	output.Printf("\n🔎 Compared with the target: %d to create, %d to update, %d unchanged\n", creates, updates, unchanged)
+	if updates > 0 {
+		output.Println("Sync only creates variables, so those to update fail, or are left as they are with --only-missing; update them in the target instead.")
+	}
+}
+
+// Writes the plan of a dry run if a report file was requested
+func writePlan(result *SyncResult) {
+	reportFile := viper.GetString("report-file")
+	if reportFile == "" {
+		return
+	}
+
+	if err := report.Write(reportFile, buildPlan(result)); err != nil {
+		pterm.Error.Printf("Failed to write plan: %v\n", err)
+		return
+	}
+	output.Printf("📄 Plan file: %s\n", reportFile)
+}
+
+// Options that would recompute decisions a plan already made, which are rejected when applying one
+var (
+	planConflictingStrings = []string{"name-prefix", "name-suffix", "only-names"}
+	planConflictingBools   = []string{"interpolate", "skip-org", "only-missing", "check-limits", "strict-limits", "strict-empty-values"}
+)
+
+// Checks that a plan is applied as reviewed, without a CSV file or options that would change its decisions
+func checkPlanOptions(inputFile string) error {
+	if inputFile != "" {
+		return fmt.Errorf("--apply-plan can't be used with --file")
+	}
+	for _, name := range planConflictingStrings {
+		if viper.GetString(optionKey(name)) != "" {
+			return fmt.Errorf("--apply-plan can't be used with --%s, as the plan already records its decisions", name)
+		}
+	}
+	for _, name := range planConflictingBools {
+		if viper.GetBool(optionKey(name)) {
+			return fmt.Errorf("--apply-plan can't be used with --%s, as the plan already records its decisions", name)
+		}
+	}
+	return nil
+}
+
+// Returns the viper key of a command option
+func optionKey(name string) string {
+	return "GHMV_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// Reads a plan written by a dry run, returning the variables to create as CSV records.
+// Planned owners and repositories are kept, so variables land where the plan said they would,
+// including organization variables routed to another organization.
+func readPlan(path, targetOrg string) ([][]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open plan %s: %v", path, err)
+	}
+	var plan SyncPlan
+	if err := json.Unmarshal(content, &plan); err != nil {
+		return nil, fmt.Errorf("cannot read plan %s: %v", path, err)
+	}
+	if !strings.EqualFold(plan.TargetOrganization, targetOrg) {
+		return nil, fmt.Errorf("plan %s targets organization %s, not %s", path, plan.TargetOrganization, targetOrg)
+	}
+
+	var records [][]string
+	for _, planned := range plan.Variables {
+		if planned.Action != planActionCreate {
+			continue
+		}
+		scope := api.EntityTypeOrg
+		if planned.Scope != api.EntityTypeOrg {
+			scope = planned.Owner + "/" + planned.Repository
+		}
+		selectedRepos := strings.Join(planned.SelectedRepositories, api.SelectedRepositoriesSeparator)
+		records = append(records, []string{planned.Name, planned.Value, scope, planned.Visibility, selectedRepos, planned.Environment, planned.Owner})
+	}
+	pterm.Info.Printf("Applying %d of %d planned variables; the rest were planned to be updated, which sync doesn't do, skipped, or to fail\n", len(records), len(plan.Variables))
+	return records, nil
+}
@@ -2,110 +2,1108 @@ package sync
 
 import (
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
 	"time"
 
 	"github.com/mona-actions/gh-migrate-variables/internal/api"
+	"github.com/mona-actions/gh-migrate-variables/internal/config"
+	"github.com/mona-actions/gh-migrate-variables/internal/output"
+	"github.com/mona-actions/gh-migrate-variables/internal/report"
+	"github.com/mona-actions/gh-migrate-variables/internal/summary"
+	"github.com/mona-actions/gh-migrate-variables/internal/variables"
 	"github.com/pterm/pterm"
 	"github.com/spf13/viper"
+	"golang.org/x/text/encoding"
 )
 
+// SyncResult captures the outcome of a sync run
+type SyncResult struct {
+	TargetOrganization string           `json:"target_organization"`
+	InputFile          string           `json:"input_file,omitempty"`
+	PlanFile           string           `json:"plan_file,omitempty"`
+	Total              int              `json:"total"`
+	Succeeded          int              `json:"succeeded"`
+	Failed             int              `json:"failed"`
+	Skipped            int              `json:"skipped"`
+	TooLarge           int              `json:"too_large"`
+	SkippedOrg         int              `json:"skipped_organization"`
+	DryRun             int              `json:"dry_run,omitempty"`
+	NotProcessed       int              `json:"not_processed,omitempty"`
+	Aborted            bool             `json:"aborted,omitempty"`
+	Variables          []VariableResult `json:"variables"`
+	DurationSeconds    float64          `json:"duration_seconds"`
+
+	// Environments created with --create-missing-environments, as owner/repo/environment
+	EnvironmentsCreated []string `json:"environments_created,omitempty"`
+
+	// Repositories the token can read but not write variables to, as owner/repo, and the variables skipped in them
+	ReadOnlyRepositories []string `json:"read_only_repositories,omitempty"`
+	SkippedReadOnly      int      `json:"skipped_read_only,omitempty"`
+
+	// When set, skipped variables are counted as failures
+	strictSkips bool
+}
+
+// VariableResult captures the outcome of syncing a single variable
+type VariableResult struct {
+	Name        string `json:"name"`
+	Scope       string `json:"scope"`
+	Environment string `json:"environment,omitempty"`
+	Visibility  string `json:"visibility"`
+	Status      string `json:"status"`
+	Error       string `json:"error,omitempty"`
+
+	// Organization an organization variable was routed to, when it isn't the target organization
+	Organization string `json:"organization,omitempty"`
+
+	// Final value and selected repositories of a dry-run variable, kept for its plan
+	value         string
+	selectedRepos []string
+
+	// How a dry run with --diff-target found the variable in the target, and the target's current value
+	change      string
+	targetValue string
+
+	// Set by a dry run for a variable that exists in the target with another value or visibility, which sync
+	// would have to update rather than create
+	needsUpdate bool
+}
+
+const (
+	statusCreated  = "created"
+	statusFailed   = "failed"
+	statusSkipped  = "skipped"
+	statusTooLarge = "too_large"
+
+	// Organization variables left out with --skip-org, which are never counted as failures
+	statusSkippedOrg = "skipped_organization"
+
+	// Variables left out with --only-missing because they already exist in the target.
+	// They count as skipped, but never as failures.
+	statusSkippedExisting = "skipped_existing"
+
+	// Variables that would have been created, had the run not been a dry run
+	statusDryRun = "dry_run"
+
+	// Variables left out because an earlier variable showed the token can't write to their repository.
+	// The variable that showed it counts as failed, so the run still fails.
+	statusSkippedReadOnly = "skipped_read_only"
+)
+
+// Data available to sync summary templates
+type syncSummary struct {
+	*SyncResult
+	TotalTime time.Duration
+}
+
+// Default summary printed once all variables are processed
+const defaultSummaryTemplate = `
+📊 Sync Summary:
+Total variables processed: {{.Total}}
+✅ Successfully created: {{.Succeeded}}
+❌ Failed: {{.Failed}}
+🚧 Skipped: {{.Skipped}}
+{{- if .SkippedOrg}}
+🏢 Skipped organization variables: {{.SkippedOrg}}
+{{- end}}
+{{- if .TooLarge}}
+📏 Exceeded size limit: {{.TooLarge}}
+{{- end}}
+{{- if .DryRun}}
+🔍 Would be created (dry run): {{.DryRun}}
+{{- end}}
+{{- if .EnvironmentsCreated}}
+🌱 Environments created: {{len .EnvironmentsCreated}}
+{{- end}}
+{{- if .ReadOnlyRepositories}}
+🔒 Read-only repositories: {{len .ReadOnlyRepositories}}, variables skipped: {{.SkippedReadOnly}}
+{{- range .ReadOnlyRepositories}}
+   - {{.}}
+{{- end}}
+{{- end}}
+{{- if .Aborted}}
+🛑 Aborted early, not processed: {{.NotProcessed}}
+{{- end}}
+🕐 Total time: {{.TotalTime}}
+`
+
+// Records the outcome of a single variable and updates the run counters
+func (r *SyncResult) record(variable VariableResult) {
+	if r.strictSkips && variable.Status == statusSkipped {
+		variable.Status = statusFailed
+	}
+
+	switch variable.Status {
+	case statusCreated:
+		r.Succeeded++
+	case statusFailed:
+		r.Failed++
+	case statusSkipped, statusSkippedExisting:
+		r.Skipped++
+	case statusTooLarge:
+		r.TooLarge++
+	case statusSkippedOrg:
+		r.SkippedOrg++
+	case statusDryRun:
+		r.DryRun++
+	case statusSkippedReadOnly:
+		r.SkippedReadOnly++
+	}
+	r.Variables = append(r.Variables, variable)
+}
+
+// Returns the variables that failed to sync, including those over the size limit
+func (r *SyncResult) failures() []VariableResult {
+	var failures []VariableResult
+	for _, variable := range r.Variables {
+		if variable.Status == statusFailed || variable.Status == statusTooLarge {
+			failures = append(failures, variable)
+		}
+	}
+	return failures
+}
+
+// Prints failed variables grouped by scope, so all errors can be reviewed in one place
+func printErrorReport(failures []VariableResult) {
+	var scopes []string
+	grouped := make(map[string][]VariableResult)
+	for _, variable := range failures {
+		scope := variable.Scope
+		if variable.Environment != "" {
+			scope += "/" + variable.Environment
+		}
+		if _, ok := grouped[scope]; !ok {
+			scopes = append(scopes, scope)
+		}
+		grouped[scope] = append(grouped[scope], variable)
+	}
+
+	// Printed as one block, so nothing printed concurrently lands in the middle of it
+	var report strings.Builder
+	report.WriteString("\n🧾 Error Report:\n")
+	for _, scope := range scopes {
+		fmt.Fprintf(&report, "%s (%d)\n", scope, len(grouped[scope]))
+		for _, variable := range grouped[scope] {
+			fmt.Fprintf(&report, "  - %s: %s\n", variable.Name, variable.Error)
+		}
+	}
+	output.Printf("%s", report.String())
+}
+
+// Writes failed variables and their errors to a CSV file
+func writeErrorFile(path string, failures []VariableResult) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("cannot create error file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if err := writer.Write([]string{"Name", "Scope", "Environment", "Visibility", "Status", "Error"}); err != nil {
+		return fmt.Errorf("failed to write error file header: %w", err)
+	}
+	for _, variable := range failures {
+		row := []string{variable.Name, variable.Scope, variable.Environment, variable.Visibility, variable.Status, variable.Error}
+		if err := writer.Write(row); err != nil {
+			return fmt.Errorf("failed to write error file: %w", err)
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Writes the sync report if a report file was requested
+func writeReport(result *SyncResult, start time.Time) {
+	reportFile := viper.GetString("report-file")
+	if reportFile == "" {
+		return
+	}
+
+	result.DurationSeconds = time.Since(start).Round(time.Millisecond).Seconds()
+	if err := report.Write(reportFile, result); err != nil {
+		pterm.Error.Printf("Failed to write report: %v\n", err)
+		return
+	}
+	output.Printf("📄 Report file: %s\n", reportFile)
+}
+
+// Reports per-variable progress, either as individual lines or as a single status line updated in place
+type progressReporter struct {
+	live    bool
+	spinner *pterm.SpinnerPrinter
+	total   int
+
+	// Leaves out the per-variable lines, keeping only warnings, errors, and the summary
+	compact bool
+}
+
+// Creates a progress reporter, falling back to plain prints when stdout is not a terminal
+func newProgressReporter(spinner *pterm.SpinnerPrinter, total int) *progressReporter {
+	live := spinner != nil && viper.GetBool("GHMV_PROGRESS") && !viper.GetBool("GHMV_VERBOSE") && output.IsTerminal()
+	return &progressReporter{live: live, spinner: spinner, total: total, compact: viper.GetBool("GHMV_COMPACT")}
+}
+
+// Prints an informational per-variable message unless the live status line replaces it or output is compact
+func (p *progressReporter) info(format string, args ...any) {
+	if !p.live && !p.compact {
+		pterm.Info.Printf(format, args...)
+	}
+}
+
+// Prints a per-variable success message unless the live status line replaces it or output is compact
+func (p *progressReporter) success(format string, args ...any) {
+	if !p.live && !p.compact {
+		pterm.Success.Printf(format, args...)
+	}
+}
+
+// Refreshes the live status line with the current counts
+func (p *progressReporter) update(result *SyncResult) {
+	if !p.live {
+		return
+	}
+	p.spinner.UpdateText(fmt.Sprintf("Syncing variables: %d/%d processed, %d succeeded, %d failed, %d skipped",
+		len(result.Variables), p.total, result.Succeeded, result.Failed+result.TooLarge, result.Skipped+result.SkippedReadOnly))
+}
+
+// Starts the spinner, or prints a plain start line when quiet or not attached to a terminal
+func startSpinner(text string) *pterm.SpinnerPrinter {
+	if viper.GetBool("GHMV_QUIET") || !output.IsTerminal() {
+		output.Println(text)
+		return nil
+	}
+	return output.StartSpinner(text)
+}
+
+// Stops the spinner with the outcome, or prints a plain end line when there is no spinner
+func stopSpinner(spinner *pterm.SpinnerPrinter, failed bool) {
+	switch {
+	case spinner == nil && failed:
+		output.Println("Sync finished: some variables failed to sync")
+	case spinner == nil:
+		output.Println("Sync finished")
+	case failed:
+		spinner.Warning("Some variables failed to sync")
+	default:
+		spinner.Success()
+	}
+}
+
+// Variable limits documented by GitHub for each scope
+const (
+	maxOrgVariables         = 1000
+	maxRepoVariables        = 500
+	maxEnvironmentVariables = 100
+)
+
+// A target scope that variables are created in: the organization, a repository, or a repository environment
+type targetScope struct {
+	org         string
+	scope       string
+	environment string
+}
+
+// Returns the number of variables a target scope already has, and GitHub's limit for it
+func countInTarget(orgSnapshots *orgSnapshotCache, repoSnapshot *api.VariableSnapshot, targetOrg string, target targetScope) (int, int, error) {
+	switch {
+	case target.scope == api.EntityTypeOrg:
+		count, err := orgSnapshots.of(target.org).OrgVariableCount()
+		return count, maxOrgVariables, err
+	case target.environment != "":
+		owner, repo := parseRepositoryScope(target.scope, targetOrg)
+		count, err := repoSnapshot.EnvVariableCount(owner, repo, target.environment)
+		return count, maxEnvironmentVariables, err
+	default:
+		owner, repo := parseRepositoryScope(target.scope, targetOrg)
+		count, err := repoSnapshot.RepoVariableCount(owner, repo)
+		return count, maxRepoVariables, err
+	}
+}
+
+// Warns about target scopes that would exceed GitHub's variable limits once the new variables are created,
+// returning how many scopes would. Variables that already exist in the target don't add to the count.
+func checkVariableLimits(records [][]string, names []string, orgSnapshots *orgSnapshotCache, repoSnapshot *api.VariableSnapshot, targetOrg string) int {
+	var targets []targetScope
+	added := make(map[targetScope]map[string]bool)
+	for i, record := range records {
+		if names[i] == "" {
+			continue
+		}
+		target := targetScope{scope: record[variables.ColumnScope], environment: variables.Column(record, variables.ColumnEnvironment)}
+		if target.scope == api.EntityTypeOrg {
+			target.org = rowOrganization(record, targetOrg)
+		}
+		if added[target] == nil {
+			added[target] = make(map[string]bool)
+			targets = append(targets, target)
+		}
+		exists, err := existsInTarget(orgSnapshots, repoSnapshot, rowOrganization(record, targetOrg), target.scope, target.environment, names[i])
+		if err == nil && !exists {
+			added[target][strings.ToUpper(names[i])] = true
+		}
+	}
+
+	exceeded := 0
+	for _, target := range targets {
+		existing, limit, err := countInTarget(orgSnapshots, repoSnapshot, targetOrg, target)
+		if err != nil {
+			pterm.Warning.Printf("Could not check the variable limit for %s: %v\n", describeScope(target), err)
+			continue
+		}
+		if projected := existing + len(added[target]); projected > limit {
+			pterm.Warning.Printf("%s would have %d variables (%d existing, %d new), exceeding GitHub's limit of %d\n",
+				describeScope(target), projected, existing, len(added[target]), limit)
+			exceeded++
+		}
+	}
+	return exceeded
+}
+
+// Describes a target scope for messages
+func describeScope(target targetScope) string {
+	switch {
+	case target.scope == api.EntityTypeOrg:
+		return "Organization " + target.org
+	case target.environment != "":
+		return fmt.Sprintf("Environment %s in %s", target.environment, target.scope)
+	default:
+		return fmt.Sprintf("Repository %s", target.scope)
+	}
+}
+
+// Snapshots of existing organization variables, one for each organization that rows are routed to
+type orgSnapshotCache struct {
+	token     string
+	hostname  string
+	snapshots map[string]*api.VariableSnapshot
+}
+
+func newOrgSnapshotCache(token, hostname string) *orgSnapshotCache {
+	return &orgSnapshotCache{token: token, hostname: hostname, snapshots: make(map[string]*api.VariableSnapshot)}
+}
+
+// Returns the snapshot of an organization, creating it on first use
+func (c *orgSnapshotCache) of(org string) *api.VariableSnapshot {
+	key := strings.ToLower(org)
+	if c.snapshots[key] == nil {
+		c.snapshots[key] = api.NewVariableSnapshot(org, c.token, c.hostname)
+	}
+	return c.snapshots[key]
+}
+
+// Reports whether a variable already exists in the target, listing each scope's variables at most once.
+// Organization variables are looked up in targetOrg, which is also the owner of bare repository names.
+func existsInTarget(orgSnapshots *orgSnapshotCache, repoSnapshot *api.VariableSnapshot, targetOrg, scope, environment, name string) (bool, error) {
+	_, found, err := targetVariable(orgSnapshots, repoSnapshot, targetOrg, scope, environment, name)
+	return found, err
+}
+
+// Returns a variable as it currently is in the target, looked up like existsInTarget
+func targetVariable(orgSnapshots *orgSnapshotCache, repoSnapshot *api.VariableSnapshot, targetOrg, scope, environment, name string) (map[string]string, bool, error) {
+	switch {
+	case scope == api.EntityTypeOrg:
+		return orgSnapshots.of(targetOrg).OrgVariable(name)
+	case environment != "":
+		owner, repo := parseRepositoryScope(scope, targetOrg)
+		return repoSnapshot.EnvVariable(owner, repo, environment, name)
+	default:
+		owner, repo := parseRepositoryScope(scope, targetOrg)
+		return repoSnapshot.RepoVariable(owner, repo, name)
+	}
+}
+
+// Reads the variables CSV from a local path, or downloads it when given an http(s) URL.
+// Files in another encoding than UTF-8 are decoded before they are parsed.
+func readInputFile(inputFile string, inputEncoding encoding.Encoding) ([]string, [][]string, error) {
+	var content []byte
+	var err error
+	if strings.HasPrefix(inputFile, "http://") || strings.HasPrefix(inputFile, "https://") {
+		content, err = api.DownloadFile(inputFile)
+	} else if content, err = os.ReadFile(inputFile); err != nil {
+		err = fmt.Errorf("cannot open file %s: %v", inputFile, err)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if inputEncoding != nil {
+		if content, err = inputEncoding.NewDecoder().Bytes(content); err != nil {
+			return nil, nil, fmt.Errorf("cannot decode file %s: %v", inputFile, err)
+		}
+	}
+	return variables.ParseCSVWithHeader(inputFile, content)
+}
+
+// Optional CSV columns that route a row to another organization or repository than the global target
+const (
+	headerTargetOrg  = "TargetOrg"
+	headerTargetRepo = "TargetRepo"
+)
+
+// Position of the organization an organization variable is routed to, appended to records by routeRecords
+const columnTargetOrg = variables.ColumnEnvironment + 1
+
+// Applies the optional TargetOrg and TargetRepo columns, found by header name. Repository scopes are rewritten
+// to owner/repo, and organization variables get their organization in columnTargetOrg. Rows leaving the columns
+// empty keep the global target.
+func routeRecords(header []string, records [][]string) error {
+	orgColumn, repoColumn := -1, -1
+	for i, name := range header {
+		switch {
+		case strings.EqualFold(strings.TrimSpace(name), headerTargetOrg):
+			orgColumn = i
+		case strings.EqualFold(strings.TrimSpace(name), headerTargetRepo):
+			repoColumn = i
+		}
+	}
+	if orgColumn < 0 && repoColumn < 0 {
+		return nil
+	}
+	// The standard columns are read by position, so routing columns must follow them
+	if (orgColumn >= 0 && orgColumn < columnTargetOrg) || (repoColumn >= 0 && repoColumn < columnTargetOrg) {
+		return fmt.Errorf("%s and %s columns must come after the %s column", headerTargetOrg, headerTargetRepo, variables.Header[variables.ColumnEnvironment])
+	}
+
+	for i, record := range records {
+		if len(record) < 4 {
+			continue
+		}
+		targetOrg := strings.TrimSpace(variables.Column(record, orgColumn))
+		targetRepo := strings.TrimSpace(variables.Column(record, repoColumn))
+
+		routed := make([]string, columnTargetOrg+1)
+		copy(routed, record[:min(len(record), columnTargetOrg)])
+		if routed[variables.ColumnScope] == api.EntityTypeOrg {
+			routed[columnTargetOrg] = targetOrg
+		} else if targetOrg != "" || targetRepo != "" {
+			owner, repo := parseRepositoryScope(routed[variables.ColumnScope], "")
+			if targetOrg != "" {
+				owner = targetOrg
+			}
+			if targetRepo != "" {
+				repo = targetRepo
+			}
+			routed[variables.ColumnScope] = repo
+			if owner != "" {
+				routed[variables.ColumnScope] = owner + "/" + repo
+			}
+		}
+		records[i] = routed
+	}
+	return nil
+}
+
+// Reports whether a failed call means every remaining call would fail too: the rate limit is exhausted
+// until after the call would time out, or the token expired or was never valid
+func stopsSync(err error) bool {
+	var exhausted *api.RateLimitExhaustedError
+	return errors.As(err, &exhausted) || errors.Is(err, api.ErrTokenExpired) || errors.Is(err, api.ErrTokenUnauthorized)
+}
+
+// Returns the organization a record's organization variable is created in
+func rowOrganization(record []string, targetOrg string) string {
+	if org := variables.Column(record, columnTargetOrg); org != "" {
+		return org
+	}
+	return targetOrg
+}
+
+// Trims a scope and spells the organization scope consistently, so hand-edited values
+// such as "Organization " aren't mistaken for repository names
+func normalizeScope(scope string) string {
+	scope = strings.TrimSpace(scope)
+	if strings.EqualFold(scope, api.EntityTypeOrg) {
+		return api.EntityTypeOrg
+	}
+	return scope
+}
+
+// Selects variables by name, from either a comma-separated list of names or a regular expression between slashes
+type nameFilter struct {
+	names   map[string]bool
+	pattern *regexp.Regexp
+}
+
+// Parses a name filter such as "API_URL,DB_HOST" or "/^DB_/". Listed names are matched case-insensitively, as GitHub does.
+func parseNameFilter(value string) (*nameFilter, error) {
+	if len(value) > 2 && strings.HasPrefix(value, "/") && strings.HasSuffix(value, "/") {
+		pattern, err := regexp.Compile(value[1 : len(value)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid name pattern %s: %w", value, err)
+		}
+		return &nameFilter{pattern: pattern}, nil
+	}
+
+	filter := &nameFilter{names: make(map[string]bool)}
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			filter.names[strings.ToUpper(name)] = true
+		}
+	}
+	if len(filter.names) == 0 {
+		return nil, fmt.Errorf("no variable names given")
+	}
+	return filter, nil
+}
+
+// Reports whether a variable name is selected by the filter
+func (f *nameFilter) matches(name string) bool {
+	if f.pattern != nil {
+		return f.pattern.MatchString(name)
+	}
+	return f.names[strings.ToUpper(name)]
+}
+
+// Values available to variable values rendered with --interpolate
+type interpolationContext struct {
+	SourceOrg  string
+	SourceHost string
+	TargetOrg  string
+	TargetHost string
+}
+
+// Returns the bare host name of a hostname that may be given as a URL, defaulting to github.com
+func hostName(hostname string) string {
+	hostname = strings.TrimPrefix(strings.TrimPrefix(hostname, "https://"), "http://")
+	hostname = strings.TrimSuffix(hostname, "/")
+	if hostname == "" {
+		return "github.com"
+	}
+	return hostname
+}
+
+// Renders a variable value as a Go template. Values without template actions are returned unchanged.
+func renderValue(value string, ctx interpolationContext) (string, error) {
+	if !strings.Contains(value, "{{") {
+		return value, nil
+	}
+	tmpl, err := template.New("value").Option("missingkey=error").Parse(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid value template: %w", err)
+	}
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, ctx); err != nil {
+		return "", fmt.Errorf("failed to render value template: %w", err)
+	}
+	return rendered.String(), nil
+}
+
+// Splits a repository scope of the form owner/repo, defaulting to the target organization for bare repository names
+func parseRepositoryScope(scope, targetOrg string) (string, string) {
+	if owner, repo, found := strings.Cut(scope, "/"); found {
+		return strings.TrimSpace(owner), strings.TrimSpace(repo)
+	}
+	return targetOrg, scope
+}
+
+// Checks that a repository scope is a bare repository name or a full name of the form owner/repo,
+// as written by other tools, so malformed scopes fail clearly instead of as API errors
+func validateRepositoryScope(scope string) error {
+	if scope == "" {
+		return fmt.Errorf("scope is empty")
+	}
+	if strings.Count(scope, "/") > 1 {
+		return fmt.Errorf("invalid repository scope %q: expected a repository name or owner/repo", scope)
+	}
+	if owner, repo, found := strings.Cut(scope, "/"); found && (strings.TrimSpace(owner) == "" || strings.TrimSpace(repo) == "") {
+		return fmt.Errorf("invalid repository scope %q: expected a repository name or owner/repo", scope)
+	}
+	return nil
+}
+
 // SyncVariables handles the syncing of variables from a CSV file to a target organization
-func SyncVariables() error {
+func SyncVariables(runtimeConfig config.RuntimeConfig) error {
 	start := time.Now()
-	spinner, _ := pterm.DefaultSpinner.Start("Sync finished...")
 
 	inputFile := viper.GetString("file")
 	hostname := viper.GetString("target-hostname")
 	targetOrg := viper.GetString("target-organization")
 	targetToken := viper.GetString("target-token")
 
-	if inputFile == "" || targetOrg == "" || targetToken == "" {
+	applyPlan := viper.GetString("GHMV_APPLY_PLAN")
+
+	if (inputFile == "" && applyPlan == "") || targetOrg == "" || targetToken == "" {
 		return fmt.Errorf("missing required parameters: mapping file, target organization, or target token")
 	}
+	if applyPlan != "" {
+		if err := checkPlanOptions(inputFile); err != nil {
+			return err
+		}
+	}
+	dryRun := viper.GetBool("GHMV_DRY_RUN")
+	diffTarget := viper.GetBool("GHMV_DIFF_TARGET")
+	if diffTarget && !dryRun {
+		return fmt.Errorf("--diff-target can only be used with --dry-run")
+	}
+	// Checked before the file is read, so a mistyped pattern fails without any other work
+	var onlyNames *nameFilter
+	if value := viper.GetString("GHMV_ONLY_NAMES"); value != "" {
+		filter, err := parseNameFilter(value)
+		if err != nil {
+			return fmt.Errorf("invalid --only-names: %w", err)
+		}
+		onlyNames = filter
+	}
 
-	file, err := os.Open(inputFile)
-	if err != nil {
-		return fmt.Errorf("cannot open file %s: %v", inputFile, err)
+	// Organization variables may need a different token than repository variables
+	orgToken := viper.GetString("target-org-token")
+	if orgToken == "" {
+		orgToken = targetToken
 	}
-	defer file.Close()
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+	// Short-lived tokens can expire partway through a long sync, and are replaced by running this command.
+	// A separate organization token isn't, as the command prints a token for --target-token.
+	if command := viper.GetString("GHMV_TARGET_TOKEN_COMMAND"); command != "" {
+		api.SetTokenCommand(targetToken, command)
+	}
+
+	var records [][]string
+	var err error
+	if applyPlan != "" {
+		records, err = readPlan(applyPlan, targetOrg)
+	} else {
+		var header []string
+		var inputEncoding encoding.Encoding
+		if inputEncoding, err = variables.LookupEncoding(viper.GetString("GHMV_INPUT_ENCODING")); err != nil {
+			return fmt.Errorf("invalid input encoding: %w", err)
+		}
+		header, records, err = readInputFile(inputFile, inputEncoding)
+		// Columns are found by header name, so files listing them in another order are read correctly
+		header, records = variables.MapColumns(header, records)
+		// Qualified scopes such as repo:<name> are read as plain scopes in the target organization
+		if err == nil {
+			err = variables.UnqualifyRecords(records, targetOrg)
+		}
+		if err == nil {
+			err = routeRecords(header, records)
+		}
+	}
 	if err != nil {
-		return fmt.Errorf("cannot read file %s: %v", inputFile, err)
+		return err
 	}
 
-	var stats struct {
-		total     int
-		succeeded int
-		failed    int
-		skipped   int
+	// Empty and header-only files have nothing to sync, so stop before reporting an empty run
+	if len(records) == 0 {
+		source := inputFile
+		if applyPlan != "" {
+			source = applyPlan
+		}
+		pterm.Warning.Printf("No variables to sync: %s has no variable rows\n", source)
+		return nil
 	}
+	spinner := startSpinner("Syncing variables...")
 
-	// Skip header row and process variables
-	for _, record := range records[1:] {
-		stats.total++
+	for _, record := range records {
+		if len(record) > variables.ColumnScope {
+			record[variables.ColumnScope] = normalizeScope(record[variables.ColumnScope])
+		}
+	}
+
+	// Re-apply only the selected variables, leaving the rest of the file out of the run entirely
+	if onlyNames != nil {
+		total := len(records)
+		records = slices.DeleteFunc(records, func(record []string) bool {
+			return !onlyNames.matches(strings.TrimSpace(variables.Column(record, variables.ColumnName)))
+		})
+		pterm.Info.Printf("Syncing %d of %d variables matching --only-names\n", len(records), total)
+	}
+
+	result := &SyncResult{
+		TargetOrganization: targetOrg,
+		InputFile:          inputFile,
+		PlanFile:           applyPlan,
+		strictSkips:        viper.GetBool("GHMV_STRICT_SKIPS"),
+	}
+
+	skipOrg := viper.GetBool("GHMV_SKIP_ORG")
+	namePrefix := viper.GetString("GHMV_NAME_PREFIX")
+	nameSuffix := viper.GetString("GHMV_NAME_SUFFIX")
+	maxFailures := runtimeConfig.MaxFailures
+	strictEmptyValues := viper.GetBool("GHMV_STRICT_EMPTY_VALUES")
+	createMissingEnvironments := viper.GetBool("GHMV_CREATE_MISSING_ENVIRONMENTS")
+	ensuredEnvironments := make(map[string]bool)
+	// Repositories found to be read-only for the token, whose remaining variables are skipped without trying them
+	readOnlyRepos := make(map[string]bool)
+	warnOnEmptyValue := viper.GetBool("GHMV_WARN_ON_EMPTY_VALUE") || strictEmptyValues
+
+	// Values may embed the source or target organization and host, rendered for the target before creation
+	interpolate := viper.GetBool("GHMV_INTERPOLATE")
+	interpolation := interpolationContext{
+		SourceOrg:  viper.GetString("source-organization"),
+		SourceHost: hostName(viper.GetString("source-hostname")),
+		TargetOrg:  targetOrg,
+		TargetHost: hostName(hostname),
+	}
+
+	// Existing target variables are only looked up when creating missing variables alone, checking limits, or planning
+	var orgSnapshots *orgSnapshotCache
+	var repoSnapshot *api.VariableSnapshot
+	onlyMissing := viper.GetBool("GHMV_ONLY_MISSING")
+	checkLimits := viper.GetBool("GHMV_CHECK_LIMITS") || viper.GetBool("GHMV_STRICT_LIMITS")
+	if onlyMissing || checkLimits || dryRun {
+		orgSnapshots = newOrgSnapshotCache(orgToken, hostname)
+		repoSnapshot = api.NewVariableSnapshot(targetOrg, targetToken, hostname)
+	}
+
+	// Check GitHub's variable limits up front rather than failing partway through the run
+	if checkLimits {
+		names := make([]string, len(records))
+		for i, record := range records {
+			if len(record) >= 4 && !(skipOrg && record[variables.ColumnScope] == api.EntityTypeOrg) {
+				names[i] = namePrefix + record[variables.ColumnName] + nameSuffix
+			}
+		}
+		exceeded := checkVariableLimits(records, names, orgSnapshots, repoSnapshot, targetOrg)
+		if exceeded > 0 && viper.GetBool("GHMV_STRICT_LIMITS") {
+			stopSpinner(spinner, true)
+			output.Printf("\n🛑 %d scopes would exceed GitHub's variable limits, no variables were synced\n", exceeded)
+			os.Exit(1)
+		}
+	}
+
+	// GitHub names are case-insensitive, so of names differing only by case, only the first can be created
+	collisions := variables.NewCaseCollisions()
+	for _, record := range records {
+		if len(record) >= 4 && !(skipOrg && record[variables.ColumnScope] == api.EntityTypeOrg) {
+			scope := record[variables.ColumnScope]
+			// Organization variables routed elsewhere don't collide with the target organization's
+			if org := rowOrganization(record, targetOrg); scope == api.EntityTypeOrg && !strings.EqualFold(org, targetOrg) {
+				scope += " " + org
+			}
+			collisions.Add(scope, variables.Column(record, variables.ColumnEnvironment), namePrefix+record[variables.ColumnName]+nameSuffix)
+		}
+	}
+	for _, collision := range collisions.Collisions() {
+		pterm.Warning.Printf("Variables %s in %s differ only by case; GitHub treats them as one variable, so only the first can be created\n",
+			strings.Join(collision.Names, ", "), collision.Location())
+	}
+
+	progress := newProgressReporter(spinner, len(records))
+
+	// Set once a call fails in a way every remaining call would too
+	var fatalErr error
+
+	// Process variables
+	for i, record := range records {
+		// Rather than fail every remaining variable the same way, stop
+		if fatalErr != nil {
+			result.Aborted = true
+			result.NotProcessed = len(records) - i
+			pterm.Error.Printf("Stopping sync, %d variables were not processed: %v\n", result.NotProcessed, fatalErr)
+			break
+		}
+		// Many failures usually mean something systemic, such as a wrong token or organization, so stop early
+		if maxFailures > 0 && result.Failed+result.TooLarge >= maxFailures {
+			result.Aborted = true
+			result.NotProcessed = len(records) - i
+			pterm.Error.Printf("Stopping sync after %d failures (--max-failures), %d variables were not processed\n",
+				result.Failed+result.TooLarge, result.NotProcessed)
+			break
+		}
+		progress.update(result)
+		result.Total++
 
 		if len(record) < 4 {
 			pterm.Warning.Printf("Warning: record %v does not have enough columns. Skipping...\n", record)
-			stats.skipped++
+			result.record(VariableResult{Status: statusSkipped, Error: "not enough columns"})
 			continue
 		}
 
-		variableName := record[0]
+		variableName := namePrefix + record[0] + nameSuffix
 		variableValue := record[1]
 		scope := record[2]
 		visibility := record[3]
 
-		pterm.Info.Printf("Syncing variable - Name: %s, Value: %s, Scope: %s, Visibility: %s\n",
+		// Selected repositories are an optional column, listed by name
+		var selectedRepos []string
+		if len(record) > 4 && record[4] != "" {
+			selectedRepos = strings.Split(record[4], api.SelectedRepositoriesSeparator)
+		}
+
+		// Environment is an optional column for environment-level variables
+		environment := ""
+		if len(record) > 5 {
+			environment = record[5]
+		}
+		variable := VariableResult{Name: variableName, Scope: scope, Environment: environment, Visibility: visibility}
+
+		// Organization variables go to the row's TargetOrg when the CSV routes them
+		rowOrg := targetOrg
+		if scope == api.EntityTypeOrg {
+			rowOrg = rowOrganization(record, targetOrg)
+			if !strings.EqualFold(rowOrg, targetOrg) {
+				variable.Organization = rowOrg
+			}
+		}
+
+		// Organization variables may be managed separately in the target
+		if skipOrg && scope == api.EntityTypeOrg {
+			progress.info("Skipping organization variable %s (--skip-org)\n", variableName)
+			variable.Status = statusSkippedOrg
+			result.record(variable)
+			continue
+		}
+
+		if interpolate {
+			rendered, err := renderValue(variableValue, interpolation)
+			if err != nil {
+				pterm.Error.Printf("Error interpolating variable %s: %v\n", variableName, err)
+				variable.Status, variable.Error = statusFailed, err.Error()
+				result.record(variable)
+				continue
+			}
+			variableValue = rendered
+		}
+
+		// Scopes may be bare repository names or owner/repo full names from other tools
+		if scope != api.EntityTypeOrg {
+			if err := validateRepositoryScope(scope); err != nil {
+				pterm.Error.Printf("Error syncing variable %s: %v\n", variableName, err)
+				variable.Status, variable.Error = statusFailed, err.Error()
+				result.record(variable)
+				continue
+			}
+		}
+
+		// Organization variables are created with exactly the visibility exported, never a default in its place
+		if scope == api.EntityTypeOrg && !slices.Contains(api.OrgVisibilityOptions, visibility) {
+			err := fmt.Errorf("invalid visibility %q for organization variable: must be one of %s", visibility, strings.Join(api.OrgVisibilityOptions, ", "))
+			pterm.Error.Printf("Error syncing variable %s: %v\n", variableName, err)
+			variable.Status, variable.Error = statusFailed, err.Error()
+			result.record(variable)
+			continue
+		}
+
+		progress.info("Syncing variable - Name: %s, Value: %s, Scope: %s, Visibility: %s\n",
 			variableName, variableValue, scope, visibility)
 
+		// A prefix or suffix can turn a valid name into one GitHub rejects, so check before creating it
+		if namePrefix != "" || nameSuffix != "" {
+			if err := variables.ValidateName(variableName); err != nil {
+				pterm.Error.Printf("Error renaming variable %s: %v\n", record[0], err)
+				variable.Status, variable.Error = statusFailed, err.Error()
+				result.record(variable)
+				continue
+			}
+		}
+
+		// Empty values are often never-populated mistakes that shouldn't propagate silently
+		if warnOnEmptyValue && variableValue == "" {
+			if strictEmptyValues {
+				pterm.Error.Printf("Variable %s in %s has an empty value\n", variableName, scope)
+				variable.Status, variable.Error = statusFailed, "value is empty"
+				result.record(variable)
+				continue
+			}
+			pterm.Warning.Printf("Variable %s in %s has an empty value\n", variableName, scope)
+		}
+
+		// Values over GitHub's size limit can never be created, so report them distinctly
+		if len(variableValue) > api.MaxVariableValueSize {
+			pterm.Error.Printf("Variable %s value is %d bytes, exceeding GitHub's %d byte limit\n", variableName, len(variableValue), api.MaxVariableValueSize)
+			variable.Status, variable.Error = statusTooLarge, api.ErrVariableValueTooLarge.Error()
+			result.record(variable)
+			continue
+		}
+
+		// Compare with the variable as it currently is in the target, for the three-way view of the dry run
+		if diffTarget {
+			variable.change, variable.targetValue = compareWithTarget(orgSnapshots, repoSnapshot, rowOrg, scope, environment, variableName, variableValue, visibility)
+			variable.value = variableValue
+		}
+
+		// Leave variables that already exist in the target untouched
+		if onlyMissing {
+			exists, err := existsInTarget(orgSnapshots, repoSnapshot, rowOrg, scope, environment, variableName)
+			if err != nil {
+				pterm.Error.Printf("Error checking whether variable %s exists: %v\n", variableName, err)
+				variable.Status, variable.Error = statusFailed, err.Error()
+				result.record(variable)
+				continue
+			}
+			if exists {
+				progress.info("Skipping variable %s: already exists in %s\n", variableName, scope)
+				variable.Status = statusSkippedExisting
+				result.record(variable)
+				continue
+			}
+		}
+
+		// Preview the variable as it would be created, without creating it
+		if dryRun {
+			location := scope
+			if variable.Organization != "" {
+				location += " " + variable.Organization
+			}
+			if environment != "" {
+				location += "/" + environment
+			}
+			// Sync only creates variables, so one that already exists would fail
+			exists, err := existsInTarget(orgSnapshots, repoSnapshot, rowOrg, scope, environment, variableName)
+			if err == nil && exists {
+				change, _ := compareWithTarget(orgSnapshots, repoSnapshot, rowOrg, scope, environment, variableName, variableValue, visibility)
+				variable.needsUpdate = change == changeUpdate
+				if variable.needsUpdate {
+					pterm.Error.Printf("Variable %s already exists in %s with another value and would fail to sync, as sync doesn't update variables\n", variableName, location)
+				} else {
+					pterm.Error.Printf("Variable %s already exists in %s and would fail to sync\n", variableName, location)
+				}
+				variable.Status, variable.Error = statusFailed, "variable already exists in the target"
+				variable.value, variable.selectedRepos = variableValue, selectedRepos
+				result.record(variable)
+				continue
+			}
+			if err != nil {
+				variable.Error = fmt.Sprintf("could not check whether the variable exists: %v", err)
+			}
+			pterm.Info.Printf("Would create variable %s in %s with value: %s\n", variableName, location, variableValue)
+			variable.Status = statusDryRun
+			variable.value, variable.selectedRepos = variableValue, selectedRepos
+			result.record(variable)
+			continue
+		}
+
 		if scope == "organization" {
-			err := api.AddOrgVariable(targetOrg, variableName, variableValue, visibility, targetToken, hostname)
+			err := api.AddOrgVariable(rowOrg, variableName, variableValue, visibility, selectedRepos, orgToken, hostname)
 			if err != nil {
 				pterm.Error.Printf("Error adding organization variable %s: %v\n", variableName, err)
-				stats.failed++
+				variable.Status, variable.Error = statusFailed, err.Error()
+				if stopsSync(err) {
+					fatalErr = err
+				}
 			} else {
-				pterm.Success.Printf("Added organization variable: %s\n", variableName)
-				stats.succeeded++
+				progress.success("Added organization variable: %s in %s\n", variableName, rowOrg)
+				variable.Status = statusCreated
 			}
 		} else {
-			err := api.AddRepoVariable(targetOrg, scope, variableName, variableValue, visibility, targetToken, hostname)
+			owner, repo := parseRepositoryScope(scope, targetOrg)
+			if readOnlyRepos[owner+"/"+repo] {
+				progress.info("Skipping variable %s: %s/%s is read-only for this token\n", variableName, owner, repo)
+				variable.Status, variable.Error = statusSkippedReadOnly, api.ErrRepositoryReadOnly.Error()
+				result.record(variable)
+				continue
+			}
+			var err error
+			// Environments missing from the target are created first when requested, once per environment
+			if environment != "" && createMissingEnvironments {
+				key := variables.Key(owner+"/"+repo, environment, "")
+				if !ensuredEnvironments[key] {
+					var created bool
+					created, err = api.EnsureEnvironment(owner, repo, environment, targetToken, hostname)
+					if created {
+						progress.success("Created environment %s in %s/%s\n", environment, owner, repo)
+						result.EnvironmentsCreated = append(result.EnvironmentsCreated, owner+"/"+repo+"/"+environment)
+					}
+					if err != nil {
+						pterm.Error.Printf("Error creating environment %s for variable %s: %v\n", environment, variableName, err)
+						variable.Status, variable.Error = statusFailed, err.Error()
+						if stopsSync(err) {
+							fatalErr = err
+						}
+						result.record(variable)
+						continue
+					}
+					ensuredEnvironments[key] = true
+				}
+			}
+			if environment != "" {
+				err = api.AddEnvVariable(owner, repo, environment, variableName, variableValue, targetToken, hostname)
+			} else {
+				err = api.AddRepoVariable(owner, repo, variableName, variableValue, visibility, targetToken, hostname)
+			}
 			if err != nil {
 				// Check if the error is due to missing repository
-				if err.Error() == fmt.Sprintf("repository %s does not exist in organization %s", scope, targetOrg) {
+				if err.Error() == fmt.Sprintf("repository %s does not exist in organization %s", repo, owner) {
 					pterm.Warning.Printf("Skipping variable %s: %v\n", variableName, err)
-					stats.skipped++
+					variable.Status, variable.Error = statusSkipped, err.Error()
 				} else {
 					pterm.Error.Printf("Error adding repository variable %s: %v\n", variableName, err)
-					stats.failed++
+					variable.Status, variable.Error = statusFailed, err.Error()
+					if stopsSync(err) {
+						fatalErr = err
+					}
+					// Every other variable of the repository would be refused the same way, so they are skipped as a batch
+					if errors.Is(err, api.ErrRepositoryReadOnly) {
+						pterm.Warning.Printf("Repository %s/%s is read-only for this token, skipping its remaining variables\n", owner, repo)
+						readOnlyRepos[owner+"/"+repo] = true
+						result.ReadOnlyRepositories = append(result.ReadOnlyRepositories, owner+"/"+repo)
+					}
 				}
 			} else {
-				pterm.Success.Printf("Added repository variable: %s in %s\n", variableName, scope)
-				stats.succeeded++
+				if environment != "" {
+					progress.success("Added environment variable: %s in %s/%s\n", variableName, scope, environment)
+				} else {
+					progress.success("Added repository variable: %s in %s\n", variableName, scope)
+				}
+				variable.Status = statusCreated
 			}
 		}
+		result.record(variable)
 	}
-	if stats.failed > 0 {
-		spinner.Warning("Some variables failed to sync")
+	progress.update(result)
+
+	stopSpinner(spinner, result.Failed > 0 || result.TooLarge > 0)
+
+	if diffTarget {
+		printTargetDiff(result)
+	}
+
+	if summary.JSON() {
+		result.DurationSeconds = time.Since(start).Round(time.Millisecond).Seconds()
+		if err := summary.PrintJSON(result); err != nil {
+			pterm.Error.Printf("%v\n", err)
+		}
 	} else {
-		spinner.Success()
+		data := syncSummary{SyncResult: result, TotalTime: time.Since(start).Round(time.Second)}
+		if err := summary.Print(viper.GetString("GHMV_SUMMARY_TEMPLATE"), defaultSummaryTemplate, data); err != nil {
+			pterm.Error.Printf("Failed to print summary: %v\n", err)
+		}
+	}
+	// A dry run's report is its plan, which --apply-plan can carry out later
+	if dryRun {
+		writePlan(result)
+	} else {
+		writeReport(result, start)
+	}
+
+	// Report every failure together, on screen or in the requested error file
+	if failures := result.failures(); len(failures) > 0 {
+		if errorFile := viper.GetString("GHMV_ERROR_FILE"); errorFile != "" {
+			if err := writeErrorFile(errorFile, failures); err != nil {
+				pterm.Error.Printf("Failed to write error file: %v\n", err)
+			} else {
+				output.Printf("🧾 Error file: %s\n", errorFile)
+			}
+		} else {
+			printErrorReport(failures)
+		}
 	}
 
-	fmt.Printf("\n📊 Sync Summary:\n")
-	fmt.Printf("Total variables processed: %d\n", stats.total)
-	fmt.Printf("✅ Successfully created: %d\n", stats.succeeded)
-	fmt.Printf("❌ Failed: %d\n", stats.failed)
-	fmt.Printf("🚧 Skipped: %d\n", stats.skipped)
-	fmt.Printf("🕐 Total time: %v\n", time.Since(start).Round(time.Second))
+	if fatalErr != nil {
+		output.Printf("\n🛑 sync aborted, %d variables were not processed: %v\n", result.NotProcessed, fatalErr)
+		os.Exit(1)
+	}
 
-	if stats.failed > 0 {
-		fmt.Printf("\n🛑 sync completed with %d failed variables\n", stats.failed)
+	if result.Aborted {
+		output.Printf("\n🛑 sync aborted after %d failed variables, %d variables were not processed\n", result.Failed+result.TooLarge, result.NotProcessed)
 		os.Exit(1)
 	}
 
-	fmt.Println("\n✅ Sync completed successfully!")
+	if result.Failed > 0 || result.TooLarge > 0 {
+		output.Printf("\n🛑 sync completed with %d failed variables\n", result.Failed+result.TooLarge)
+		os.Exit(1)
+	}
+
+	if dryRun {
+		output.Println("\n✅ Dry run completed, no variables were created")
+		return nil
+	}
+	output.Println("\n✅ Sync completed successfully!")
 	return nil
 }
@@ -0,0 +1,140 @@
+package validate
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mona-actions/gh-migrate-variables/internal/api"
+	"github.com/mona-actions/gh-migrate-variables/internal/variables"
+	"github.com/pterm/pterm"
+	"github.com/spf13/viper"
+)
+
+// A reason a CSV row can't be synced as-is, at the line it starts on
+type problem struct {
+	line    int
+	name    string
+	message string
+}
+
+// ValidateVariables checks a variables CSV file before it is handed to sync, without calling the API,
+// and reports every problem found with its line number
+func ValidateVariables() error {
+	file := viper.GetString("GHMV_VALIDATE_FILE")
+	if file == "" {
+		return fmt.Errorf("a CSV file is required")
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("cannot open file %s: %v", file, err)
+	}
+	header, records, lines, err := variables.ParseCSVWithLines(file, content)
+	if err != nil {
+		return err
+	}
+	// Sync reads columns by header name, so their order doesn't matter here either
+	header, records = variables.MapColumns(header, records)
+
+	problems := checkHeader(header)
+	problems = append(problems, checkRecords(records, lines)...)
+
+	if len(problems) > 0 {
+		rows := [][]string{{"Line", "Name", "Problem"}}
+		for _, problem := range problems {
+			rows = append(rows, []string{strconv.Itoa(problem.line), problem.name, problem.message})
+		}
+		pterm.DefaultTable.WithHasHeader().WithData(rows).Render()
+	}
+
+	fmt.Printf("\n📊 Validation Summary:\n")
+	fmt.Printf("File: %s\n", file)
+	fmt.Printf("📝 Variables checked: %d\n", len(records))
+	fmt.Printf("❌ Problems: %d\n", len(problems))
+
+	if len(problems) > 0 {
+		fmt.Printf("\n🛑 Found %d problems\n", len(problems))
+		os.Exit(1)
+	}
+
+	fmt.Println("\n✅ File is valid!")
+	return nil
+}
+
+// Checks that the header names the required columns, which MapColumns has put in order. Optional and extra columns may follow.
+func checkHeader(header []string) []problem {
+	if header == nil {
+		return []problem{{line: 1, message: "file is empty"}}
+	}
+	required := variables.Header[:variables.ColumnSelectedRepositories]
+	for i, column := range variables.Header {
+		if i >= len(header) {
+			if i < len(required) {
+				return []problem{{line: 1, message: fmt.Sprintf("header is missing the %s column; expected %s", column, strings.Join(variables.Header, ","))}}
+			}
+			break
+		}
+		if !strings.EqualFold(strings.TrimSpace(header[i]), column) {
+			return []problem{{line: 1, message: fmt.Sprintf("column %d of the header is %q, expected %s", i+1, header[i], column)}}
+		}
+	}
+	return nil
+}
+
+// Checks each record's columns, name, visibility, and value size, and that no variable appears twice
+func checkRecords(records [][]string, lines []int) []problem {
+	var problems []problem
+	// GitHub names are case-insensitive, so names differing only by case are duplicates too
+	seen := make(map[string]int)
+	for i, record := range records {
+		name := strings.TrimSpace(variables.Column(record, variables.ColumnName))
+		report := func(format string, args ...any) {
+			problems = append(problems, problem{line: lines[i], name: name, message: fmt.Sprintf(format, args...)})
+		}
+
+		if len(record) < 4 {
+			report("has %d columns, at least 4 are required", len(record))
+			continue
+		}
+
+		// Qualified scopes such as repo:<name> are checked as the plain scope they stand for
+		record, err := variables.UnqualifyRecord(record, "")
+		if err != nil {
+			report("%v", err)
+			continue
+		}
+
+		if err := variables.ValidateName(name); err != nil {
+			report("%v", err)
+		}
+
+		scope := strings.TrimSpace(record[variables.ColumnScope])
+		visibility := record[variables.ColumnVisibility]
+		switch {
+		case scope == "":
+			report("scope is empty")
+		case strings.EqualFold(scope, api.EntityTypeOrg):
+			if !slices.Contains(api.OrgVisibilityOptions, visibility) {
+				report("invalid visibility %q: must be one of %s", visibility, strings.Join(api.OrgVisibilityOptions, ", "))
+			}
+		}
+
+		if size := len(record[variables.ColumnValue]); size > api.MaxVariableValueSize {
+			report("value is %d bytes, exceeding GitHub's %d byte limit", size, api.MaxVariableValueSize)
+		}
+
+		if scope != "" && strings.EqualFold(scope, api.EntityTypeOrg) {
+			scope = api.EntityTypeOrg
+		}
+		key := variables.Key(scope, strings.TrimSpace(variables.Column(record, variables.ColumnEnvironment)), strings.ToUpper(name))
+		if first, ok := seen[key]; ok {
+			report("duplicate of the variable on line %d", first)
+		} else {
+			seen[key] = lines[i]
+		}
+	}
+	return problems
+}